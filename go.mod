@@ -20,6 +20,19 @@ require (
 	// A test library.
 	github.com/stretchr/testify v1.8.4
 
+	// Deduplicates the concurrent fetches of the same credentials.
+	golang.org/x/sync v0.5.0
+
+	// The token buckets of the client-side rate limits.
+	golang.org/x/time v0.5.0
+
+	// YAML decoder. The same one gophertelekomcloud uses to load the clouds.yaml.
+	gopkg.in/yaml.v2 v2.4.0
+
+	// https://github.com/kubernetes/api
+	// The Kubernetes API types, e.g. the secrets watched by the informers.
+	k8s.io/api v0.29.0
+
 	// https://github.com/kubernetes/apiextensions-apiserver
 	// This API server provides the implementation for CustomResourceDefinitions which is included as delegate server inside of kube-apiserver.
 	// apiextensions-apiserver v0.18.0 >>> Kubernetes 1.18
@@ -30,6 +43,10 @@ require (
 	// Client library to talk to Kubernetes. client-go v0.18.0 >>> Kubernetes 1.18
 	k8s.io/client-go v0.29.0
 
+	// https://github.com/kubernetes/component-base
+	// The metrics registry served by the webhook apiserver on /metrics.
+	k8s.io/component-base v0.29.0
+
 	// https://github.com/kubernetes/klog/tree/v2.9.0
 	k8s.io/klog v1.0.0
 )
@@ -104,11 +121,9 @@ require (
 	golang.org/x/mod v0.14.0 // indirect
 	golang.org/x/net v0.24.0 // indirect
 	golang.org/x/oauth2 v0.15.0 // indirect
-	golang.org/x/sync v0.5.0 // indirect
 	golang.org/x/sys v0.19.0 // indirect
 	golang.org/x/term v0.19.0 // indirect
 	golang.org/x/text v0.14.0 // indirect
-	golang.org/x/time v0.5.0 // indirect
 	golang.org/x/tools v0.16.1 // indirect
 	google.golang.org/appengine v1.6.8 // indirect
 	google.golang.org/genproto v0.0.0-20240102182953-50ed04b92917 // indirect
@@ -118,11 +133,8 @@ require (
 	google.golang.org/protobuf v1.33.0 // indirect
 	gopkg.in/inf.v0 v0.9.1 // indirect
 	gopkg.in/natefinch/lumberjack.v2 v2.2.1 // indirect
-	gopkg.in/yaml.v2 v2.4.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
-	k8s.io/api v0.29.0 // indirect
 	k8s.io/apiserver v0.29.0 // indirect
-	k8s.io/component-base v0.29.0 // indirect
 	k8s.io/klog/v2 v2.110.1 // indirect
 	k8s.io/kms v0.29.0 // indirect
 	k8s.io/kube-openapi v0.0.0-20240103051144-eec4567ac022 // indirect
@@ -0,0 +1,351 @@
+// The tests in this file test the auth options of the authentication methods of the solver
+// and the authentication against a fake IAM.
+package otcdns
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	otc "github.com/opentelekomcloud/gophertelekomcloud"
+	otcos "github.com/opentelekomcloud/gophertelekomcloud/openstack"
+	"github.com/opentelekomcloud/gophertelekomcloud/openstack/dns/v2/zones"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// Returns a solver, that reads the given secrets from a fake Kubernetes API.
+func newSolverWithSecrets(t *testing.T, secrets ...*corev1.Secret) *OtcDnsSolver {
+	objects := make([]runtime.Object, 0, len(secrets))
+	for _, secret := range secrets {
+		objects = append(objects, secret)
+	}
+	stopCh := make(chan struct{})
+	t.Cleanup(func() { close(stopCh) })
+
+	solver := NewSolver().(*OtcDnsSolver)
+	solver.secrets = newSecretCache(fake.NewSimpleClientset(objects...), stopCh)
+	return solver
+}
+
+// Returns the value at the given path of a decoded JSON object, e.g. "identity", "methods".
+func getJsonPath(object map[string]interface{}, path ...string) interface{} {
+	var value interface{} = object
+	for _, key := range path {
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = m[key]
+	}
+	return value
+}
+
+// Tests, if the IAM user authentication is selected with authType "password", and if the AK/SK authentication is the default.
+func TestGetAuthOptionsWithPassword(t *testing.T) {
+	config := &OtcDnsConfig{AuthURL: "https://iam.eu-de.otc.t-systems.com/v3", AuthType: AuthTypePassword}
+	secrets := &Credentials{Username: "dns-user", Password: "dns-password", DomainName: "dns-domain", ProjectID: "project-a"}
+
+	authOpts, err := getAuthOptions(config, secrets)
+	if assert.NoError(t, err) {
+		passwordAuthOpts := authOpts.(otc.AuthOptions)
+		assert.Equal(t, "https://iam.eu-de.otc.t-systems.com/v3", passwordAuthOpts.IdentityEndpoint)
+		assert.Equal(t, "dns-user", passwordAuthOpts.Username)
+		assert.Equal(t, "dns-password", passwordAuthOpts.Password)
+		assert.Equal(t, "dns-domain", passwordAuthOpts.DomainName)
+		assert.Equal(t, "project-a", passwordAuthOpts.TenantID, "The token must be scoped to the project ID of the secret.")
+	}
+
+	authOpts, err = getAuthOptions(&OtcDnsConfig{}, &Credentials{AccessKey: "ak", SecretKey: "sk"})
+	if assert.NoError(t, err) {
+		akskAuthOpts := authOpts.(otc.AKSKAuthOptions)
+		assert.Equal(t, "ak", akskAuthOpts.AccessKey)
+		assert.Equal(t, "sk", akskAuthOpts.SecretKey)
+	}
+
+	_, err = getAuthOptions(&OtcDnsConfig{AuthType: "unknown"}, secrets)
+	assert.ErrorContains(t, err, `unknown authType "unknown"`)
+}
+
+// Tests, if the security token of temporary AK/SK credentials is passed to the auth options.
+func TestGetAuthOptionsWithSecurityToken(t *testing.T) {
+	authOpts, err := getAuthOptions(&OtcDnsConfig{}, &Credentials{AccessKey: "ak", SecretKey: "sk", SecurityToken: "security-token"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "security-token", authOpts.(otc.AKSKAuthOptions).SecurityToken)
+	}
+}
+
+// Tests, if the security token is sent to the IAM, and if rejected temporary credentials are reported as expired.
+func TestNewDNSV2ClientWithExpiredTemporaryCredentials(t *testing.T) {
+	var securityTokens []string
+	iam := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		securityTokens = append(securityTokens, r.Header.Get(securityTokenHeader))
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(`{"error_code": "APIGW.0301", "error_msg": "Incorrect IAM authentication information"}`))
+	}))
+	defer iam.Close()
+
+	authOpts := otc.AKSKAuthOptions{
+		IdentityEndpoint: iam.URL + "/v3",
+		ProjectId:        "project-id",
+		AccessKey:        "ak",
+		SecretKey:        "sk",
+		SecurityToken:    "expired-security-token",
+	}
+	_, err := NewDNSV2ClientWithAuth(authOpts, otc.EndpointOpts{Region: "eu-de"})
+	assert.True(t, errors.Is(err, ErrTemporaryCredentialsExpired), "Rejected temporary credentials must be reported as expired. Got: %v", err)
+	if assert.NotEmpty(t, securityTokens) {
+		assert.Equal(t, "expired-security-token", securityTokens[0])
+	}
+}
+
+// Tests, if the agency is passed to the auth options of every authentication method, and if incomplete agencies are rejected.
+func TestGetAuthOptionsWithAgency(t *testing.T) {
+	config := &OtcDnsConfig{
+		AuthURL:          "https://iam.eu-de.otc.t-systems.com/v3",
+		DomainName:       "workload-domain",
+		AgencyName:       "dns-admin",
+		AgencyDomainName: "dns-domain",
+		DelegatedProject: "eu-de_dns",
+	}
+
+	authOpts, err := getAuthOptions(config, &Credentials{AccessKey: "ak", SecretKey: "sk"})
+	if assert.NoError(t, err) {
+		akskAuthOpts := authOpts.(otc.AKSKAuthOptions)
+		assert.Equal(t, "workload-domain", akskAuthOpts.Domain)
+		assert.Equal(t, "dns-admin", akskAuthOpts.AgencyName)
+		assert.Equal(t, "dns-domain", akskAuthOpts.AgencyDomainName)
+		assert.Equal(t, "eu-de_dns", akskAuthOpts.DelegatedProject)
+	}
+
+	config.AuthType = AuthTypePassword
+	authOpts, err = getAuthOptions(config, &Credentials{Username: "user", Password: "password", DomainName: "workload-domain"})
+	if assert.NoError(t, err) {
+		passwordAuthOpts := authOpts.(otc.AuthOptions)
+		assert.Equal(t, "dns-admin", passwordAuthOpts.AgencyName)
+		assert.Equal(t, "dns-domain", passwordAuthOpts.AgencyDomainName)
+		assert.Equal(t, "eu-de_dns", passwordAuthOpts.DelegatedProject)
+	}
+
+	authOpts, err = getAuthOptions(config, &Credentials{Token: "token"})
+	if assert.NoError(t, err) {
+		tokenAuthOpts := authOpts.(otc.AuthOptions)
+		assert.Equal(t, "dns-admin", tokenAuthOpts.AgencyName)
+		assert.Equal(t, "dns-domain", tokenAuthOpts.AgencyDomainName)
+		assert.Equal(t, "eu-de_dns", tokenAuthOpts.DelegatedProject)
+	}
+
+	_, err = getAuthOptions(&OtcDnsConfig{AgencyName: "dns-admin", AgencyDomainName: "dns-domain"}, &Credentials{AccessKey: "ak", SecretKey: "sk"})
+	assert.ErrorContains(t, err, "domainName is missing", "The SDK needs the domain of the AK/SK credentials to assume an agency.")
+
+	_, err = getAuthOptions(&OtcDnsConfig{AgencyName: "dns-admin"}, &Credentials{Username: "user", Password: "password"})
+	assert.ErrorContains(t, err, "agencyDomainName is missing")
+}
+
+// Tests, if the project ID and the project name are passed to the auth options,
+// and if the project ID of the secrets takes precedence over the configured project ID.
+func TestGetAuthOptionsWithProject(t *testing.T) {
+	authOpts, err := getAuthOptions(&OtcDnsConfig{ProjectID: "project-a", ProjectName: "eu-de_dns"}, &Credentials{AccessKey: "ak", SecretKey: "sk"})
+	if assert.NoError(t, err) {
+		akskAuthOpts := authOpts.(otc.AKSKAuthOptions)
+		assert.Equal(t, "project-a", akskAuthOpts.ProjectId)
+		assert.Equal(t, "eu-de_dns", akskAuthOpts.ProjectName)
+	}
+
+	authOpts, err = getAuthOptions(&OtcDnsConfig{AuthType: AuthTypePassword, ProjectID: "project-a", ProjectName: "eu-de_dns"}, &Credentials{Username: "user", Password: "password"})
+	if assert.NoError(t, err) {
+		passwordAuthOpts := authOpts.(otc.AuthOptions)
+		assert.Equal(t, "project-a", passwordAuthOpts.TenantID)
+		assert.Equal(t, "eu-de_dns", passwordAuthOpts.TenantName)
+	}
+
+	authOpts, err = getAuthOptions(&OtcDnsConfig{AuthType: AuthTypePassword, ProjectID: "project-a"}, &Credentials{Username: "user", Password: "password", ProjectID: "project-b"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "project-b", authOpts.(otc.AuthOptions).TenantID)
+	}
+}
+
+// Tests, if a client scoped to a project keeps the zones of its project only, and if a domain scoped client keeps all zones.
+func TestFilterZonesByProject(t *testing.T) {
+	allZones := []zones.Zone{
+		{ID: "zone-a", ProjectID: "project-a"},
+		{ID: "zone-b", ProjectID: "project-b"},
+		{ID: "zone-without-project"},
+	}
+
+	projectZones := (&OtcDnsClient{ProjectID: "project-a"}).filterZonesByProject(allZones)
+	var zoneIDs []string
+	for _, zone := range projectZones {
+		zoneIDs = append(zoneIDs, zone.ID)
+	}
+	assert.Equal(t, []string{"zone-a", "zone-without-project"}, zoneIDs)
+
+	assert.Len(t, (&OtcDnsClient{}).filterZonesByProject(allZones), 3)
+}
+
+// Tests, if a configuration without any credential references asks for the ambient credentials.
+func TestHasCredentials(t *testing.T) {
+	config := &OtcDnsConfig{Region: "eu-de", AuthURL: "https://iam.eu-de.otc.t-systems.com/v3", ProjectID: "project-a"}
+	assert.False(t, config.hasCredentials())
+
+	config.SecurityTokenSecretRef.Name = "otcdns-credentials"
+	assert.True(t, config.hasCredentials())
+	assert.True(t, (&OtcDnsConfig{AccessKey: "ak"}).hasCredentials())
+}
+
+// Tests, that an issuer without credentials falls back to the ambient credentials of the webhook only, when cert-manager allows it.
+func TestSolverAmbientCredentials(t *testing.T) {
+	dns := newFakeDns(t, fakeZone{ID: "zone", Name: "example.com."})
+	iam := newFakeIam(t, dns)
+	// The OS_* variables of the test environment must not be used.
+	envOS := EnvOS
+	EnvOS = otcos.NewEnv("OTCDNS_TEST_OS_")
+	t.Cleanup(func() { EnvOS = envOS })
+	t.Setenv("OTCDNS_TEST_OS_AUTH_URL", iam.authURL())
+	t.Setenv("OTCDNS_TEST_OS_USERNAME", "platform-user")
+	t.Setenv("OTCDNS_TEST_OS_PASSWORD", "platform-password")
+	t.Setenv("OTCDNS_TEST_OS_DOMAIN_NAME", "platform-domain")
+	t.Setenv("OTCDNS_TEST_OS_PROJECT_ID", "platform-project")
+	t.Setenv("OTCDNS_TEST_OS_REGION_NAME", "eu-de")
+
+	solver := NewSolver().(*OtcDnsSolver)
+	config := &OtcDnsConfig{Region: "eu-de"}
+
+	_, err := solver.getOtcDnsClientFromConfig(config, "team-a", false)
+	assert.ErrorContains(t, err, "ambient credentials are not allowed")
+	assert.Zero(t, iam.getAuthentications(), "The credentials of the webhook must not be used, when ambient credentials are not allowed.")
+
+	otcDnsClient, err := solver.getOtcDnsClientFromConfig(config, "cert-manager", true)
+	if err != nil {
+		t.Fatalf("Unable to create client: %v", err)
+	}
+	assert.Equal(t, "platform-project", otcDnsClient.ProjectID)
+	tokenRequests := iam.getTokenRequests()
+	if assert.Len(t, tokenRequests, 1) {
+		assert.Equal(t, "platform-user", getJsonPath(tokenRequests[0].Auth, "identity", "password", "user", "name"))
+	}
+}
+
+// Tests, if an IAM user authenticates with the username, the password and the domain name of the referenced secret,
+// and if the token is scoped to the project ID of the secret.
+func TestSolverAuthenticatesWithPassword(t *testing.T) {
+	dns := newFakeDns(t, fakeZone{ID: "zone", Name: "example.com.", ProjectID: "project-a"})
+	iam := newFakeIam(t, dns)
+	solver := newSolverWithSecrets(t, &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "otcdns-user"},
+		Data: map[string][]byte{
+			"username":   []byte("dns-user"),
+			"password":   []byte("dns-password"),
+			"domainName": []byte("dns-domain"),
+			"projectID":  []byte("project-a"),
+		},
+	})
+	config := &OtcDnsConfig{
+		AuthURL:             iam.authURL(),
+		Region:              "eu-de",
+		AuthType:            AuthTypePassword,
+		UsernameSecretRef:   newSecretKeySelector("otcdns-user", "username"),
+		PasswordSecretRef:   newSecretKeySelector("otcdns-user", "password"),
+		DomainNameSecretRef: newSecretKeySelector("otcdns-user", "domainName"),
+		ProjectIDSecretRef:  newSecretKeySelector("otcdns-user", "projectID"),
+	}
+
+	otcDnsClient, err := solver.getOtcDnsClientFromConfig(config, "team-a", false)
+	if err != nil {
+		t.Fatalf("Unable to create client: %v", err)
+	}
+	assert.Equal(t, "project-a", otcDnsClient.ProjectID)
+
+	tokenRequests := iam.getTokenRequests()
+	if assert.Len(t, tokenRequests, 1) {
+		auth := tokenRequests[0].Auth
+		assert.Equal(t, []interface{}{"password"}, getJsonPath(auth, "identity", "methods"))
+		assert.Equal(t, "dns-user", getJsonPath(auth, "identity", "password", "user", "name"))
+		assert.Equal(t, "dns-password", getJsonPath(auth, "identity", "password", "user", "password"))
+		assert.Equal(t, "dns-domain", getJsonPath(auth, "identity", "password", "user", "domain", "name"))
+		assert.Equal(t, "project-a", getJsonPath(auth, "scope", "project", "id"))
+	}
+
+	zone, err := otcDnsClient.GetHostedZoneWithContext(context.Background(), "example.com.")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "zone", zone.ID)
+	}
+	for _, request := range dns.getRequests("GET /zones") {
+		assert.Equal(t, "token-1", request.Header.Get("X-Auth-Token"), "The DNS must be called with the token of the IAM user.")
+	}
+}
+
+// Tests, that the authentication fails with the name of the missing secret, when a password secret is missing.
+func TestSolverAuthenticatesWithPasswordMissingSecret(t *testing.T) {
+	iam := newFakeIam(t, nil)
+	solver := newSolverWithSecrets(t, &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "otcdns-user"},
+		Data:       map[string][]byte{"username": []byte("dns-user")},
+	})
+	config := &OtcDnsConfig{
+		AuthURL:             iam.authURL(),
+		Region:              "eu-de",
+		AuthType:            AuthTypePassword,
+		UsernameSecretRef:   newSecretKeySelector("otcdns-user", "username"),
+		PasswordSecretRef:   newSecretKeySelector("otcdns-user", "password"),
+		DomainNameSecretRef: newSecretKeySelector("otcdns-user", "domainName"),
+	}
+
+	_, err := solver.getOtcDnsClientFromConfig(config, "team-a", false)
+	assert.ErrorContains(t, err, "cannot get password")
+	assert.Empty(t, iam.getTokenRequests(), "The IAM must not be called without a password.")
+}
+
+// Tests, if the agency is assumed with the token of the local credentials, and if the DNS is called with the delegated token.
+func TestSolverAssumesAgency(t *testing.T) {
+	dns := newFakeDns(t, fakeZone{ID: "zone", Name: "example.com."})
+	iam := newFakeIam(t, dns)
+	solver := newSolverWithSecrets(t, &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "otcdns-user"},
+		Data: map[string][]byte{
+			"username":   []byte("dns-user"),
+			"password":   []byte("dns-password"),
+			"domainName": []byte("workload-domain"),
+		},
+	})
+	config := &OtcDnsConfig{
+		AuthURL:             iam.authURL(),
+		Region:              "eu-de",
+		AuthType:            AuthTypePassword,
+		UsernameSecretRef:   newSecretKeySelector("otcdns-user", "username"),
+		PasswordSecretRef:   newSecretKeySelector("otcdns-user", "password"),
+		DomainNameSecretRef: newSecretKeySelector("otcdns-user", "domainName"),
+		AgencyName:          "dns-admin",
+		AgencyDomainName:    "dns-domain",
+		DelegatedProject:    "eu-de_dns",
+	}
+
+	otcDnsClient, err := solver.getOtcDnsClientFromConfig(config, "team-a", false)
+	if err != nil {
+		t.Fatalf("Unable to create client: %v", err)
+	}
+
+	tokenRequests := iam.getTokenRequests()
+	if assert.Len(t, tokenRequests, 2) {
+		assert.Equal(t, []interface{}{"password"}, getJsonPath(tokenRequests[0].Auth, "identity", "methods"))
+
+		assumeRole := tokenRequests[1]
+		assert.Equal(t, "token-1", assumeRole.AuthToken, "The agency must be assumed with the token of the local credentials.")
+		assert.Equal(t, []interface{}{"assume_role"}, getJsonPath(assumeRole.Auth, "identity", "methods"))
+		assert.Equal(t, "dns-admin", getJsonPath(assumeRole.Auth, "identity", "assume_role", "xrole_name"))
+		assert.Equal(t, "dns-domain", getJsonPath(assumeRole.Auth, "identity", "assume_role", "domain_name"))
+		assert.Equal(t, "eu-de_dns", getJsonPath(assumeRole.Auth, "scope", "project", "name"))
+	}
+
+	_, err = otcDnsClient.ListZonesWithContext(context.Background())
+	assert.NoError(t, err)
+	requests := dns.getRequests("GET /zones")
+	if assert.NotEmpty(t, requests) {
+		assert.Equal(t, "token-2", requests[0].Header.Get("X-Auth-Token"), "The DNS must be called with the delegated token.")
+	}
+}
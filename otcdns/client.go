@@ -5,18 +5,37 @@
 package otcdns
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
+	"sync"
+	"time"
 
 	otc "github.com/opentelekomcloud/gophertelekomcloud"
 	otcos "github.com/opentelekomcloud/gophertelekomcloud/openstack"
 	"github.com/opentelekomcloud/gophertelekomcloud/openstack/dns/v2/recordsets"
 	"github.com/opentelekomcloud/gophertelekomcloud/openstack/dns/v2/zones"
+	"github.com/opentelekomcloud/gophertelekomcloud/pagination"
 )
 
 const (
 	dnsRecordTypeTxt     string = "TXT"
 	dnsRecordDescription string = "ACME Challenge"
 	acmeChallengePrefix  string = "_acme-challenge."
+	// The Subdomain of a recordset at the apex of the zone.
+	zoneApex string = "@"
+)
+
+//
+// The zone types, that can be selected with OtcDnsConfig.ZoneType.
+//
+const (
+	ZoneTypePublic  string = "public"
+	ZoneTypePrivate string = "private"
+	// Looks up the public and the private zones. The name must be unique across both.
+	ZoneTypeBoth string = "both"
 )
 
 //
@@ -25,20 +44,127 @@ const (
 type OtcDnsClient struct {
 	Sc *otc.ServiceClient
 
+	//
+	// The ID of the project the client is scoped to. Empty, if the client is scoped to the domain.
+	//
+	ProjectID string
+
+	//
+	// The account (IAM domain) of the client. The rate limits apply per account.
+	//
+	AccountID string
+
 	//
 	// Optional subdomain, which will be inserted between "_acme-challenge." and the zone name.
+	// "@" selects the apex of the zone.
 	//
 	Subdomain string
+
+	//
+	// The timeouts of the operations. A timeout of 0 means no timeout.
+	//
+	Timeouts OperationTimeouts
+
+	//
+	// The retries of failed requests. No request is retried by default.
+	//
+	Retry RetryPolicy
+
+	//
+	// Optional rate limiter, that is shared by all clients of the same account.
+	//
+	RateLimiter RateLimiter
+
+	//
+	// The type of the zones the client looks up: "public", "private" or "both". The API lists the public zones by default.
+	//
+	ZoneType string
+
+	//
+	// Optional ID of the router (VPC) a private zone must be associated with. Public zones are not filtered.
+	//
+	RouterID string
+
+	//
+	// How long the creations, updates and deletions of recordsets are awaited. They are not awaited by default.
+	//
+	StatusWait StatusWaitPolicy
+
+	//
+	// The TTL of the created recordsets in seconds. 300, when it is 0.
+	//
+	TTL int
+
+	//
+	// The description of the created recordsets. "ACME Challenge", when it is empty.
+	//
+	Description string
+
+	//
+	// Optional tags of the created recordsets.
+	//
+	Tags map[string]string
+
+	//
+	// Guards the token of the provider client, which is shared by the copies of the client.
+	// The copies of the provider client of the operations are taken under the read lock, the re-authentications
+	// hold the write lock.
+	//
+	authMutex *sync.RWMutex
+
+	//
+	// The time the token of the authentication expires. Zero, when it is unknown or there is no token, e.g. with AK/SK.
+	//
+	TokenExpiresAt time.Time
+
+	//
+	// Set, when the client was authenticated with a given token. The token cannot be renewed by the client.
+	//
+	hasTokenID bool
+
+	//
+	// Optional. Called, when the API rejects the given token. The client cache evicts the client then.
+	//
+	onTokenRejected func()
+}
+
+//
+// The timeouts of the DNS operations. Each request of an operation is cancelled, when its timeout has passed.
+//
+type OperationTimeouts struct {
+	// Zone lookups and recordset listings.
+	Read   time.Duration
+	Create time.Duration
+	Update time.Duration
+	Delete time.Duration
 }
 
+//
+// Returned when the OTC IAM rejects temporary AK/SK credentials.
+// Temporary credentials are only valid for a limited time and must be renewed before they expire.
+//
+var ErrTemporaryCredentialsExpired = errors.New("the temporary security credentials have expired or were revoked")
+
+//
+// Returned when the OTC IAM or the DNS API rejects a pre-issued token.
+// Tokens are only valid for 24 hours at most and must be replaced before they expire.
+//
+var ErrTokenExpired = errors.New("the IAM token has expired or was revoked")
+
 //
 // Creates a new DNSv2 ServiceClient.
 // See also gophertelekomcloud/acceptance/clients/clients.go
 //
 func NewDNSV2ClientWithAuth(authOpts otc.AuthOptionsProvider, endpointOpts otc.EndpointOpts) (*OtcDnsClient, error) {
 
-	providerClient, err := getProviderClientWithAccessKeyAuth(authOpts)
+	providerClient, tokenExpiresAt, err := getProviderClientWithTokenExpiry(authOpts)
 	if err != nil {
+		if hasSecurityToken(authOpts) && isAuthenticationError(err) {
+			return nil, fmt.Errorf("cannot create providerClient. %w. Request new temporary credentials from the IAM and update the referenced secrets. %s", ErrTemporaryCredentialsExpired, err)
+		}
+		if hasTokenID(authOpts) && isTokenRejectedError(err) {
+			return nil, fmt.Errorf("cannot create providerClient. %w. Request a new token and update the referenced secret. %s", ErrTokenExpired, err)
+		}
 		return nil, fmt.Errorf("cannot create providerClient. %s", err)
 	}
 
@@ -47,7 +173,14 @@ func NewDNSV2ClientWithAuth(authOpts otc.AuthOptionsProvider, endpointOpts otc.E
 		return nil, fmt.Errorf("cannot create serviceClient. %s", err)
 	}
 
-	return &OtcDnsClient{Sc: serviceClient}, nil
+	return &OtcDnsClient{
+		Sc:             serviceClient,
+		ProjectID:      providerClient.ProjectID,
+		AccountID:      getAccountID(providerClient),
+		authMutex:      &sync.RWMutex{},
+		TokenExpiresAt: tokenExpiresAt,
+		hasTokenID:     hasTokenID(authOpts),
+	}, nil
 }
 
 //
@@ -73,7 +206,161 @@ func NewDNSV2Client() (*OtcDnsClient, error) {
 		return nil, err
 	}
 
-	return &OtcDnsClient{Sc: serviceClient}, nil
+	return &OtcDnsClient{Sc: serviceClient, ProjectID: providerClient.ProjectID, AccountID: getAccountID(providerClient), authMutex: &sync.RWMutex{}}, nil
+}
+
+//
+// Creates a new DNSv2 ServiceClient with the ambient credentials of the webhook.
+// The credentials are loaded from the OS_* environment variables and/or the clouds.yaml of the webhook container.
+// The region of the cloud is used, when no region is given.
+//
+func NewDNSV2ClientFromEnv(region string) (*OtcDnsClient, error) {
+	cloud, err := getAmbientCloud()
+	if err != nil {
+		return nil, err
+	}
+
+	return NewDNSV2ClientFromCloud(cloud, region)
+}
+
+//
+// Creates a new DNSv2 ServiceClient from the given cloud configuration, e.g. a profile of a clouds.yaml.
+// The region of the cloud is used, when no region is given.
+//
+func NewDNSV2ClientFromCloud(cloud *otcos.Cloud, region string) (*OtcDnsClient, error) {
+	authOpts, endpointOpts, err := getAuthOptionsFromCloud(cloud, region)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewDNSV2ClientWithAuth(authOpts, endpointOpts)
+}
+
+//
+// Builds the auth options and the endpoint options from the given cloud configuration.
+// The region of the cloud is used, when no region is given.
+//
+func getAuthOptionsFromCloud(cloud *otcos.Cloud, region string) (otc.AuthOptionsProvider, otc.EndpointOpts, error) {
+	authOpts, err := otcos.AuthOptionsFromInfo(&cloud.AuthInfo, cloud.AuthType)
+	if err != nil {
+		return nil, otc.EndpointOpts{}, fmt.Errorf("cannot create auth options from cloud %s. %s", cloud.Cloud, err)
+	}
+
+	if region == "" {
+		region = cloud.RegionName
+	}
+	endpointOpts := otc.EndpointOpts{
+		Region: region,
+	}
+
+	return authOpts, endpointOpts, nil
+}
+
+//
+// Tests, if the given auth options carry temporary AK/SK credentials.
+//
+func hasSecurityToken(authOpts otc.AuthOptionsProvider) bool {
+	akskAuthOpts, ok := authOpts.(otc.AKSKAuthOptions)
+	return ok && akskAuthOpts.SecurityToken != ""
+}
+
+//
+// Tests, if the given auth options carry a pre-issued token.
+//
+func hasTokenID(authOpts otc.AuthOptionsProvider) bool {
+	tokenAuthOpts, ok := authOpts.(otc.AuthOptions)
+	return ok && tokenAuthOpts.TokenID != ""
+}
+
+//
+// Returns ErrTokenExpired, when the API rejected the given token of the client with the given error.
+// The client cannot renew the token. It is evicted from the client cache, so that the next challenge reads the token again.
+//
+func (dnsClient *OtcDnsClient) wrapTokenRejectedError(err error) error {
+	if !dnsClient.hasTokenID || !isAuthenticationError(err) {
+		return err
+	}
+	if dnsClient.onTokenRejected != nil {
+		dnsClient.onTokenRejected()
+	}
+	return fmt.Errorf("%w. Request a new token and update the referenced secret. %s", ErrTokenExpired, err)
+}
+
+//
+// Tests, if the given error was caused by the OTC rejecting a token.
+// The IAM answers the validation of an expired or unknown token with 404.
+//
+func isTokenRejectedError(err error) bool {
+	var err404 otc.ErrDefault404
+	var unexpectedResponse otc.ErrUnexpectedResponseCode
+	switch {
+	case errors.As(err, &err404):
+		return true
+	case errors.As(err, &unexpectedResponse) && unexpectedResponse.Actual == http.StatusNotFound:
+		return true
+	default:
+		return isAuthenticationError(err)
+	}
+}
+
+//
+// Tests, if the given error was caused by the OTC rejecting the credentials.
+// A 403 only counts, when its error code says, that the credentials are invalid or expired.
+// Otherwise the credentials are valid, but lack a permission.
+//
+func isAuthenticationError(err error) bool {
+	var unexpectedResponse otc.ErrUnexpectedResponseCode
+	var err401 otc.ErrDefault401
+	var err403 otc.ErrDefault403
+	var unableToReauth *otc.ErrUnableToReauthenticate
+	switch {
+	case errors.As(err, &err401), errors.As(err, &unableToReauth):
+		return true
+	case errors.As(err, &err403):
+		return isExpiredCredentialsErrorCode(getErrorCode(err403.Body))
+	case errors.As(err, &unexpectedResponse):
+		return unexpectedResponse.Actual == http.StatusUnauthorized ||
+			unexpectedResponse.Actual == http.StatusForbidden && isExpiredCredentialsErrorCode(getErrorCode(unexpectedResponse.Body))
+	default:
+		return false
+	}
+}
+
+//
+// The error codes the API gateway of the OTC answers invalid or expired credentials with.
+//
+var expiredCredentialsErrorCodes = map[string]bool{
+	// Incorrect IAM authentication information.
+	"APIGW.0301": true,
+	// The token must be updated.
+	"APIGW.0307": true,
+}
+
+func isExpiredCredentialsErrorCode(errorCode string) bool {
+	return expiredCredentialsErrorCodes[errorCode]
+}
+
+//
+// Returns the error code of an error response of the OTC. The API gateway answers with
+// {"error_code": "...", "error_msg": "..."}, the IAM with {"error": {"code": "...", "message": "..."}}.
+//
+func getErrorCode(body []byte) string {
+	var errorResponse struct {
+		ErrorCode string `json:"error_code"`
+		Error     struct {
+			Code interface{} `json:"code"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(body, &errorResponse); err != nil {
+		return ""
+	}
+	if errorResponse.ErrorCode != "" {
+		return errorResponse.ErrorCode
+	}
+	if code, ok := errorResponse.Error.Code.(string); ok {
+		return code
+	}
+	return ""
 }
 
 // ===========================================================================
@@ -86,21 +373,18 @@ func NewDNSV2Client() (*OtcDnsClient, error) {
 // github.com/opentelekomcloud/gophertelekomcloud/openstack/dns/v2/zones
 //
 func (dnsClient *OtcDnsClient) GetHostedZone(zoneName string) (*zones.Zone, error) {
+	return dnsClient.GetHostedZoneWithContext(context.Background(), zoneName)
+}
 
-	listOpts := zones.ListOpts{
-		Name: zoneName,
-	}
-
-	allPages, err := zones.List(dnsClient.Sc, listOpts).AllPages()
+//
+// Retrieves a Zone data structure by its name. The request is cancelled with the context or after the read timeout.
+//
+func (dnsClient *OtcDnsClient) GetHostedZoneWithContext(ctx context.Context, zoneName string) (*zones.Zone, error) {
+	allZones, err := dnsClient.listZones(ctx, zoneName)
 	if err != nil {
 		return nil, fmt.Errorf("zone %s not found: %s", zoneName, err)
 	}
 
-	allZones, err := zones.ExtractZones(allPages)
-	if err != nil {
-		return nil, fmt.Errorf("zone %s extraction failed: %s", zoneName, err)
-	}
-
 	// Debug
 	//for _, zone := range allZones {
 	//	fmt.Printf("%+v\n", zone)
@@ -114,6 +398,143 @@ func (dnsClient *OtcDnsClient) GetHostedZone(zoneName string) (*zones.Zone, erro
 	return &allZones[0], nil
 }
 
+//
+// Retrieves a Zone data structure by its ID.
+//
+func (dnsClient *OtcDnsClient) GetHostedZoneByID(zoneID string) (*zones.Zone, error) {
+	return dnsClient.GetHostedZoneByIDWithContext(context.Background(), zoneID)
+}
+
+//
+// Retrieves a Zone data structure by its ID. The request is cancelled with the context or after the read timeout.
+//
+func (dnsClient *OtcDnsClient) GetHostedZoneByIDWithContext(ctx context.Context, zoneID string) (*zones.Zone, error) {
+	var zone *zones.Zone
+	err := dnsClient.withRetries(ctx, "get zone "+zoneID, dnsClient.Timeouts.Read, func(sc *otc.ServiceClient, retry int) error {
+		var err error
+		zone, err = zones.Get(sc, zoneID).Extract()
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("zone with ID %s not found: %s", zoneID, err)
+	}
+
+	return zone, nil
+}
+
+//
+// Lists all zones the client can access.
+//
+func (dnsClient *OtcDnsClient) ListZones() ([]zones.Zone, error) {
+	return dnsClient.ListZonesWithContext(context.Background())
+}
+
+//
+// Lists all zones the client can access. The request is cancelled with the context or after the read timeout.
+//
+func (dnsClient *OtcDnsClient) ListZonesWithContext(ctx context.Context) ([]zones.Zone, error) {
+	return dnsClient.listZones(ctx, "")
+}
+
+//
+// Lists the zones of the zone types of the client with the given name. All zones, when the name is empty.
+// The private zones are filtered by the router of the client.
+//
+func (dnsClient *OtcDnsClient) listZones(ctx context.Context, zoneName string) ([]zones.Zone, error) {
+	zoneTypes, err := dnsClient.getZoneTypes()
+	if err != nil {
+		return nil, err
+	}
+
+	var allZones []zones.Zone
+	for _, zoneType := range zoneTypes {
+		listOpts := zones.ListOpts{
+			Name: zoneName,
+			Type: zoneType,
+		}
+
+		var allPages pagination.Page
+		err := dnsClient.withRetries(ctx, "list zones "+zoneName, dnsClient.Timeouts.Read, func(sc *otc.ServiceClient, retry int) error {
+			var err error
+			allPages, err = zones.List(sc, listOpts).AllPages()
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("list zones failed: %s", err)
+		}
+
+		typeZones, err := zones.ExtractZones(allPages)
+		if err != nil {
+			return nil, fmt.Errorf("zone extraction failed: %s", err)
+		}
+		allZones = append(allZones, typeZones...)
+	}
+
+	return dnsClient.filterZonesByRouter(dnsClient.filterZonesByProject(allZones)), nil
+}
+
+//
+// Removes the zones that are owned by another project than the one the client is scoped to.
+// A domain scoped client keeps all zones.
+//
+func (dnsClient *OtcDnsClient) filterZonesByProject(allZones []zones.Zone) []zones.Zone {
+	if dnsClient.ProjectID == "" {
+		return allZones
+	}
+	projectZones := make([]zones.Zone, 0, len(allZones))
+	for _, zone := range allZones {
+		if zone.ProjectID == "" || zone.ProjectID == dnsClient.ProjectID {
+			projectZones = append(projectZones, zone)
+		}
+	}
+	return projectZones
+}
+
+//
+// Returns the zone types the zones are listed for. An empty type lists the zones the API returns by default.
+//
+func (dnsClient *OtcDnsClient) getZoneTypes() ([]string, error) {
+	switch dnsClient.ZoneType {
+	case "":
+		return []string{""}, nil
+	case ZoneTypePublic, ZoneTypePrivate:
+		return []string{dnsClient.ZoneType}, nil
+	case ZoneTypeBoth:
+		return []string{ZoneTypePublic, ZoneTypePrivate}, nil
+	default:
+		return nil, fmt.Errorf("unknown zoneType %q", dnsClient.ZoneType)
+	}
+}
+
+//
+// Removes the private zones that are not associated with the router of the client.
+// All zones are kept, when no router is set.
+//
+func (dnsClient *OtcDnsClient) filterZonesByRouter(allZones []zones.Zone) []zones.Zone {
+	if dnsClient.RouterID == "" {
+		return allZones
+	}
+	routerZones := make([]zones.Zone, 0, len(allZones))
+	for _, zone := range allZones {
+		if zone.ZoneType != ZoneTypePrivate || isZoneAssociatedWithRouter(zone, dnsClient.RouterID) {
+			routerZones = append(routerZones, zone)
+		}
+	}
+	return routerZones
+}
+
+//
+// Tests, if the private zone is associated with the given router.
+//
+func isZoneAssociatedWithRouter(zone zones.Zone, routerID string) bool {
+	for _, router := range zone.Routers {
+		if router.RouterID == routerID {
+			return true
+		}
+	}
+	return false
+}
+
 // ===========================================================================
 // RecordSets
 // ===========================================================================
@@ -124,21 +545,59 @@ func (dnsClient *OtcDnsClient) GetHostedZone(zoneName string) (*zones.Zone, erro
 // github.com/opentelekomcloud/gophertelekomcloud/openstack/dns/v2/recordsets
 //
 func (dnsClient *OtcDnsClient) NewTxtRecordSet(zone *zones.Zone, challengeValue string) (*recordsets.RecordSet, error) {
+	return dnsClient.NewTxtRecordSetWithContext(context.Background(), zone, challengeValue)
+}
+
+//
+// Creates a new TXT recordset for the ACME challenge. The request is cancelled with the context or after the create timeout.
+// Returns the ACTIVE recordset, when the client has a StatusWait timeout.
+//
+func (dnsClient *OtcDnsClient) NewTxtRecordSetWithContext(ctx context.Context, zone *zones.Zone, challengeValue string) (*recordsets.RecordSet, error) {
 	dnsName := dnsClient.getDnsName(zone.Name)
 	createOpts := recordsets.CreateOpts{
 		Name:        dnsName,
 		Type:        dnsRecordTypeTxt,
-		TTL:         300,
+		TTL:         defaultRecordSetTTL,
 		Description: dnsRecordDescription,
 		Records:     []string{challengeValue},
 	}
+	if dnsClient.TTL != 0 {
+		createOpts.TTL = dnsClient.TTL
+	}
+	if dnsClient.Description != "" {
+		createOpts.Description = dnsClient.Description
+	}
 	var pCreatedRecordset *recordsets.RecordSet
-	pCreatedRecordset, err := recordsets.Create(dnsClient.Sc, zone.ID, createOpts).Extract()
+	err := dnsClient.withRetries(ctx, "create recordset "+dnsName, dnsClient.Timeouts.Create, func(sc *otc.ServiceClient, retry int) error {
+		if retry > 0 {
+			// The previous attempt may have created the recordset, although its response was lost. Do not create it twice.
+			existingRecordset, err := findTxtRecordSetWithValue(sc, zone, dnsName, challengeValue)
+			if err != nil {
+				return err
+			}
+			if existingRecordset != nil {
+				pCreatedRecordset = existingRecordset
+				return nil
+			}
+		}
+		var err error
+		if len(dnsClient.Tags) > 0 {
+			pCreatedRecordset, err = recordsets.Create(sc, zone.ID, taggedRecordSetCreateOpts{CreateOpts: createOpts, Tags: dnsClient.Tags}).Extract()
+		} else {
+			pCreatedRecordset, err = recordsets.Create(sc, zone.ID, createOpts).Extract()
+		}
+		return err
+	})
 	if err != nil {
 		return nil, fmt.Errorf("create TXT record failed for %s: %s", challengeValue, err)
 	}
 
-	return pCreatedRecordset, nil
+	pActiveRecordset, err := dnsClient.waitForRecordSetActive(ctx, zone, pCreatedRecordset)
+	if err != nil {
+		return nil, fmt.Errorf("create TXT record failed for %s: %w", challengeValue, err)
+	}
+
+	return pActiveRecordset, nil
 }
 
 //
@@ -147,20 +606,16 @@ func (dnsClient *OtcDnsClient) NewTxtRecordSet(zone *zones.Zone, challengeValue
 // Error if query is not successful or more than 1 result.
 //
 func (dnsClient *OtcDnsClient) GetTxtRecordSet(zone *zones.Zone) (*recordsets.RecordSet, error) {
-	dnsName := dnsClient.getDnsName(zone.Name)
-	listOpts := recordsets.ListOpts{
-		Type: dnsRecordTypeTxt,
-		Name: dnsName,
-	}
-
-	allPages, err := recordsets.ListByZone(dnsClient.Sc, zone.ID, listOpts).AllPages()
-	if err != nil {
-		return nil, fmt.Errorf("list records failed for dns entry %s: %s", dnsName, err)
-	}
+	return dnsClient.GetTxtRecordSetWithContext(context.Background(), zone)
+}
 
-	allRRs, err := recordsets.ExtractRecordSets(allPages)
+//
+// Reads the TXT recordset created for the ACME challenge. The request is cancelled with the context or after the read timeout.
+//
+func (dnsClient *OtcDnsClient) GetTxtRecordSetWithContext(ctx context.Context, zone *zones.Zone) (*recordsets.RecordSet, error) {
+	allRRs, err := dnsClient.listTxtRecordSets(ctx, zone)
 	if err != nil {
-		return nil, fmt.Errorf("extract recordset failed for dns entry %s: %s", dnsName, err)
+		return nil, err
 	}
 
 	// Debug
@@ -176,7 +631,7 @@ func (dnsClient *OtcDnsClient) GetTxtRecordSet(zone *zones.Zone) (*recordsets.Re
 		return nil, nil
 	} else {
 		// More than 1 result.
-		return nil, fmt.Errorf("query with %s returned %d recordsets. Expected: 1", dnsName, len(allRRs))
+		return nil, fmt.Errorf("query with %s returned %d recordsets. Expected: 1", dnsClient.getDnsName(zone.Name), len(allRRs))
 	}
 }
 
@@ -184,20 +639,16 @@ func (dnsClient *OtcDnsClient) GetTxtRecordSet(zone *zones.Zone) (*recordsets.Re
 // Tests, if a TXT recordset exists for the ACME challenge.
 //
 func (dnsClient *OtcDnsClient) HasTxtRecordSet(zone *zones.Zone) (bool, error) {
-	dnsName := dnsClient.getDnsName(zone.Name)
-	listOpts := recordsets.ListOpts{
-		Type: dnsRecordTypeTxt,
-		Name: dnsName,
-	}
-
-	allPages, err := recordsets.ListByZone(dnsClient.Sc, zone.ID, listOpts).AllPages()
-	if err != nil {
-		return false, fmt.Errorf("list records failed for dns name %s: %s", dnsName, err)
-	}
+	return dnsClient.HasTxtRecordSetWithContext(context.Background(), zone)
+}
 
-	allRRs, err := recordsets.ExtractRecordSets(allPages)
+//
+// Tests, if a TXT recordset exists for the ACME challenge. The request is cancelled with the context or after the read timeout.
+//
+func (dnsClient *OtcDnsClient) HasTxtRecordSetWithContext(ctx context.Context, zone *zones.Zone) (bool, error) {
+	allRRs, err := dnsClient.listTxtRecordSets(ctx, zone)
 	if err != nil {
-		return false, fmt.Errorf("extract recordset failed for dns name %s: %s", dnsName, err)
+		return false, err
 	}
 
 	// Debug
@@ -213,8 +664,59 @@ func (dnsClient *OtcDnsClient) HasTxtRecordSet(zone *zones.Zone) (bool, error) {
 		return false, nil
 	} else {
 		// More than 1 result.
-		return false, fmt.Errorf("query with %s returned %d recordsets. Expected: 1", dnsName, len(allRRs))
+		return false, fmt.Errorf("query with %s returned %d recordsets. Expected: 1", dnsClient.getDnsName(zone.Name), len(allRRs))
+	}
+}
+
+//
+// Lists the TXT recordsets with the name of the ACME challenge.
+//
+func (dnsClient *OtcDnsClient) listTxtRecordSets(ctx context.Context, zone *zones.Zone) ([]recordsets.RecordSet, error) {
+	dnsName := dnsClient.getDnsName(zone.Name)
+	listOpts := recordsets.ListOpts{
+		Type: dnsRecordTypeTxt,
+		Name: dnsName,
+	}
+
+	var allPages pagination.Page
+	err := dnsClient.withRetries(ctx, "list recordsets "+dnsName, dnsClient.Timeouts.Read, func(sc *otc.ServiceClient, retry int) error {
+		var err error
+		allPages, err = recordsets.ListByZone(sc, zone.ID, listOpts).AllPages()
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list records failed for dns entry %s: %s", dnsName, err)
 	}
+
+	allRRs, err := recordsets.ExtractRecordSets(allPages)
+	if err != nil {
+		return nil, fmt.Errorf("extract recordset failed for dns entry %s: %s", dnsName, err)
+	}
+
+	return allRRs, nil
+}
+
+//
+// Looks for a TXT recordset with the given name, that contains the given value.
+// Returns nil, when there is none.
+//
+func findTxtRecordSetWithValue(sc *otc.ServiceClient, zone *zones.Zone, dnsName string, value string) (*recordsets.RecordSet, error) {
+	allPages, err := recordsets.ListByZone(sc, zone.ID, recordsets.ListOpts{Type: dnsRecordTypeTxt, Name: dnsName}).AllPages()
+	if err != nil {
+		return nil, err
+	}
+	allRRs, err := recordsets.ExtractRecordSets(allPages)
+	if err != nil {
+		return nil, err
+	}
+	for i := range allRRs {
+		for _, record := range allRRs[i].Records {
+			if record == value {
+				return &allRRs[i], nil
+			}
+		}
+	}
+	return nil, nil
 }
 
 //
@@ -222,11 +724,32 @@ func (dnsClient *OtcDnsClient) HasTxtRecordSet(zone *zones.Zone) (bool, error) {
 // created for the ACME challenge.
 //
 func (dnsClient *OtcDnsClient) DeleteRecordSet(zone *zones.Zone, recordset *recordsets.RecordSet) error {
-	err := recordsets.Delete(dnsClient.Sc, zone.ID, recordset.ID).ExtractErr()
+	return dnsClient.DeleteRecordSetWithContext(context.Background(), zone, recordset)
+}
+
+//
+// Deletes the given recordset. The request is cancelled with the context or after the delete timeout.
+// Waits until the recordset is gone, when the client has a StatusWait timeout.
+//
+func (dnsClient *OtcDnsClient) DeleteRecordSetWithContext(ctx context.Context, zone *zones.Zone, recordset *recordsets.RecordSet) error {
+	err := dnsClient.withRetries(ctx, "delete recordset "+recordset.ID, dnsClient.Timeouts.Delete, func(sc *otc.ServiceClient, retry int) error {
+		err := recordsets.Delete(sc, zone.ID, recordset.ID).ExtractErr()
+		var err404 otc.ErrDefault404
+		if retry > 0 && errors.As(err, &err404) {
+			// The previous attempt deleted the recordset, although its response was lost.
+			return nil
+		}
+		return err
+	})
 	if err != nil {
 		return fmt.Errorf("deletion of record with zoneId %s and recordsetId %s failed: %s", zone.ID, recordset.ID, err)
 	}
 
+	err = dnsClient.waitForRecordSetDeleted(ctx, zone, recordset)
+	if err != nil {
+		return fmt.Errorf("deletion of record with zoneId %s and recordsetId %s failed: %w", zone.ID, recordset.ID, err)
+	}
+
 	return nil
 }
 
@@ -238,7 +761,14 @@ func (dnsClient *OtcDnsClient) DeleteRecordSet(zone *zones.Zone, recordset *reco
 // Tests, if the given challengeValue exists in the TXT records of the recordset.
 //
 func (dnsClient *OtcDnsClient) HasTxtRecordValue(zone *zones.Zone, challengeValue string) (bool, *recordsets.RecordSet, error) {
-	recordSet, err := dnsClient.GetTxtRecordSet(zone)
+	return dnsClient.HasTxtRecordValueWithContext(context.Background(), zone, challengeValue)
+}
+
+//
+// Tests, if the given challengeValue exists in the TXT records of the recordset. The request is cancelled with the context or after the read timeout.
+//
+func (dnsClient *OtcDnsClient) HasTxtRecordValueWithContext(ctx context.Context, zone *zones.Zone, challengeValue string) (bool, *recordsets.RecordSet, error) {
+	recordSet, err := dnsClient.GetTxtRecordSetWithContext(ctx, zone)
 	if err != nil {
 		return false, nil, fmt.Errorf("failed to get recordset. %s", err)
 	}
@@ -270,20 +800,38 @@ func (dnsClient *OtcDnsClient) HasTxtRecordValue(zone *zones.Zone, challengeValu
 // The challengeValues must have at least one entry. The OTC API has a bug. When we send an empty array the values are not deleted as expected.
 //
 func (dnsClient *OtcDnsClient) UpdateTxtRecordValues(zone *zones.Zone, recordset *recordsets.RecordSet, challengeValues []string) (*recordsets.RecordSet, error) {
+	return dnsClient.UpdateTxtRecordValuesWithContext(context.Background(), zone, recordset, challengeValues)
+}
+
+//
+// Updates the given recordset with the set of TXT records. The request is cancelled with the context or after the update timeout.
+// Returns the ACTIVE recordset, when the client has a StatusWait timeout.
+//
+func (dnsClient *OtcDnsClient) UpdateTxtRecordValuesWithContext(ctx context.Context, zone *zones.Zone, recordset *recordsets.RecordSet, challengeValues []string) (*recordsets.RecordSet, error) {
 	if len(challengeValues) == 0 {
 		return nil, fmt.Errorf("update TXT records failed. The challengeValue records must have at least one entry")
 	}
+
 	updateOpts := recordsets.UpdateOpts{
 		Records: challengeValues,
 	}
+	// The update replaces all records. Sending it again has the same result.
 	var pUpdatedRecordSet *recordsets.RecordSet
-	var err error
-	pUpdatedRecordSet, err = recordsets.Update(dnsClient.Sc, zone.ID, recordset.ID, updateOpts).Extract()
+	err := dnsClient.withRetries(ctx, "update recordset "+recordset.ID, dnsClient.Timeouts.Update, func(sc *otc.ServiceClient, retry int) error {
+		var err error
+		pUpdatedRecordSet, err = recordsets.Update(sc, zone.ID, recordset.ID, updateOpts).Extract()
+		return err
+	})
 	if err != nil {
 		return nil, fmt.Errorf("update TXT records failed for recordset ID %s: %s", recordset.ID, err)
 	}
 
-	return pUpdatedRecordSet, nil
+	pActiveRecordSet, err := dnsClient.waitForRecordSetActive(ctx, zone, pUpdatedRecordSet)
+	if err != nil {
+		return nil, fmt.Errorf("update TXT records failed for recordset ID %s: %w", recordset.ID, err)
+	}
+
+	return pActiveRecordSet, nil
 }
 
 //
@@ -294,7 +842,15 @@ func (dnsClient *OtcDnsClient) UpdateTxtRecordValues(zone *zones.Zone, recordset
 //     If this is set to true, the whole recordset is deleted, when there value to delete is the last one.
 //
 func (dnsClient *OtcDnsClient) DeleteTxtRecordValue(zone *zones.Zone, challengeValue string, deleteRecordsetIfEmpty bool) (*recordsets.RecordSet, error) {
-	challengeValueExists, existingRecordset, err := dnsClient.HasTxtRecordValue(zone, challengeValue)
+	return dnsClient.DeleteTxtRecordValueWithContext(context.Background(), zone, challengeValue, deleteRecordsetIfEmpty)
+}
+
+//
+// Deletes the given TXT value from the records for the ACME challenge.
+// Each request is cancelled with the context or after the timeout of its operation.
+//
+func (dnsClient *OtcDnsClient) DeleteTxtRecordValueWithContext(ctx context.Context, zone *zones.Zone, challengeValue string, deleteRecordsetIfEmpty bool) (*recordsets.RecordSet, error) {
+	challengeValueExists, existingRecordset, err := dnsClient.HasTxtRecordValueWithContext(ctx, zone, challengeValue)
 	if err != nil {
 		return nil, fmt.Errorf("failed to check existence of DNS TXT entry. %s", err)
 	}
@@ -312,7 +868,7 @@ func (dnsClient *OtcDnsClient) DeleteTxtRecordValue(zone *zones.Zone, challengeV
 			changedRecords := append(existingRecordset.Records[:deleteIndex], existingRecordset.Records[deleteIndex+1:]...)
 			if len(changedRecords) == 0 {
 				if deleteRecordsetIfEmpty {
-					err := dnsClient.DeleteRecordSet(zone, existingRecordset)
+					err := dnsClient.DeleteRecordSetWithContext(ctx, zone, existingRecordset)
 					if err != nil {
 						return nil, fmt.Errorf("failed to delete recordset. %s", err)
 					}
@@ -323,7 +879,7 @@ func (dnsClient *OtcDnsClient) DeleteTxtRecordValue(zone *zones.Zone, challengeV
 			} else {
 				var pChangedRecordset *recordsets.RecordSet
 				var err error
-				pChangedRecordset, err = dnsClient.UpdateTxtRecordValues(zone, existingRecordset, changedRecords)
+				pChangedRecordset, err = dnsClient.UpdateTxtRecordValuesWithContext(ctx, zone, existingRecordset, changedRecords)
 				if err != nil {
 					return nil, fmt.Errorf("failed to update DNS TXT entry with deleted record. %s", err)
 				}
@@ -340,11 +896,112 @@ func (dnsClient *OtcDnsClient) DeleteTxtRecordValue(zone *zones.Zone, challengeV
 	}
 }
 
+// ===========================================================================
+// Context
+// ===========================================================================
+
+//
+// Returns a service client, whose requests are cancelled with the given context or after the given timeout.
+// A timeout of 0 means no timeout. The returned cancel function must be called, when the operation is done.
+// The returned transport records the last response of the service client.
+//
+// The SDK creates its requests without a context. The context is therefore bound to the requests in the HTTP transport
+// of a copy of the provider client. The shared provider client of the cached clients is not modified.
+//
+func (dnsClient *OtcDnsClient) serviceClientWithTimeout(ctx context.Context, timeout time.Duration) (*otc.ServiceClient, *contextTransport, context.CancelFunc) {
+	cancel := context.CancelFunc(func() {})
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	}
+
+	providerClient := dnsClient.copyProviderClient()
+	transport := &contextTransport{ctx: ctx, next: providerClient.HTTPClient.Transport, limiter: dnsClient.RateLimiter}
+	providerClient.HTTPClient.Transport = transport
+	if providerClient.ReauthFunc != nil {
+		// The token is renewed in the shared provider client. The copy takes over the new token.
+		// The SDK holds the token lock of the copy during the re-authentication.
+		providerClient.ReauthFunc = func() error {
+			token, err := dnsClient.reauthenticate(providerClient.TokenID)
+			if err != nil {
+				return err
+			}
+			providerClient.TokenID = token
+			return nil
+		}
+	}
+
+	serviceClient := *dnsClient.Sc
+	serviceClient.ProviderClient = providerClient
+	return &serviceClient, transport, cancel
+}
+
+//
+// Copies the shared provider client under the read lock. A re-authentication changes the token, the project
+// and the endpoint locator of the shared provider client.
+//
+func (dnsClient *OtcDnsClient) copyProviderClient() *otc.ProviderClient {
+	mutex := dnsClient.getAuthMutex()
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	original := dnsClient.Sc.ProviderClient
+	providerClient := &otc.ProviderClient{
+		IdentityBase:     original.IdentityBase,
+		IdentityEndpoint: original.IdentityEndpoint,
+		TokenID:          original.TokenID,
+		ProjectID:        original.ProjectID,
+		UserID:           original.UserID,
+		DomainID:         original.DomainID,
+		EndpointLocator:  original.EndpointLocator,
+		HTTPClient:       original.HTTPClient,
+		UserAgent:        original.UserAgent,
+		ReauthFunc:       original.ReauthFunc,
+		AKSKAuthOptions:  original.AKSKAuthOptions,
+	}
+	// The copy is shared by the requests of one operation only. The token of the copy is guarded by its own lock.
+	providerClient.UseTokenLock()
+	return providerClient
+}
+
+//
+// Renews the token of the shared provider client, after the given token was rejected. The re-authentications are
+// serialized. The token is not renewed again, when another operation renewed the rejected token in the meantime.
+//
+func (dnsClient *OtcDnsClient) reauthenticate(rejectedToken string) (string, error) {
+	mutex := dnsClient.getAuthMutex()
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	original := dnsClient.Sc.ProviderClient
+	if original.TokenID != "" && original.TokenID != rejectedToken {
+		return original.TokenID, nil
+	}
+	if err := original.ReauthFunc(); err != nil {
+		return "", err
+	}
+	return original.TokenID, nil
+}
+
+//
+// Returns the lock of the shared provider client. Clients, that were not created with a constructor of this package,
+// share a common lock.
+//
+func (dnsClient *OtcDnsClient) getAuthMutex() *sync.RWMutex {
+	if dnsClient.authMutex == nil {
+		return &commonAuthMutex
+	}
+	return dnsClient.authMutex
+}
+
+var commonAuthMutex sync.RWMutex
+
 //
 // Ensures that a valid subdomain part is set.
 //
 func (dnsClient *OtcDnsClient) getDnsName(zoneName string) string {
-	if dnsClient.Subdomain == "" {
+	if dnsClient.Subdomain == zoneApex {
+		return zoneName
+	} else if dnsClient.Subdomain == "" {
 		dnsName := acmeChallengePrefix + zoneName
 		return dnsName
 	} else {
@@ -0,0 +1,106 @@
+// The tests in this file test the timeouts and the cancellation of the DNS operations,
+// and the copies of the shared provider client the operations are made with.
+package otcdns
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	otc "github.com/opentelekomcloud/gophertelekomcloud"
+	"github.com/opentelekomcloud/gophertelekomcloud/openstack/dns/v2/recordsets"
+	"github.com/opentelekomcloud/gophertelekomcloud/openstack/dns/v2/zones"
+	"github.com/stretchr/testify/assert"
+)
+
+// Tests, if an operation is aborted after its timeout.
+func TestOperationTimeout(t *testing.T) {
+	dns := newFakeDns(t)
+	dns.failWith = hangUntilCancelled
+
+	otcDnsClient := dns.client()
+	otcDnsClient.Timeouts.Read = 100 * time.Millisecond
+
+	start := time.Now()
+	_, err := otcDnsClient.GetHostedZoneWithContext(context.Background(), "example.com.")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), context.DeadlineExceeded.Error())
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
+
+// Tests, if an operation is aborted, when its context is cancelled.
+func TestOperationCancelled(t *testing.T) {
+	dns := newFakeDns(t)
+	dns.failWith = hangUntilCancelled
+	recordSet := dns.addRecordSet(fakeRecordSet{ZoneID: "zone"})
+
+	otcDnsClient := dns.client()
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	start := time.Now()
+	err := otcDnsClient.DeleteRecordSetWithContext(ctx, &zones.Zone{ID: "zone"}, &recordsets.RecordSet{ID: recordSet.ID})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), context.Canceled.Error())
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
+
+// Tests, if the context is bound to a copy of the provider client. The shared client must stay unchanged.
+func TestOperationWithContextKeepsSharedClient(t *testing.T) {
+	dns := newFakeDns(t, fakeZone{ID: "zone", Name: "example.com."})
+
+	otcDnsClient := dns.client()
+	otcDnsClient.Timeouts.Read = time.Minute
+
+	zone, err := otcDnsClient.GetHostedZoneWithContext(context.Background(), "example.com.")
+	assert.NoError(t, err)
+	assert.Equal(t, "zone", zone.ID)
+	for _, request := range dns.getRequests("GET /zones") {
+		assert.Equal(t, "token", request.Header.Get("X-Auth-Token"))
+	}
+	assert.Nil(t, otcDnsClient.Sc.ProviderClient.HTTPClient.Transport)
+}
+
+// Tests, that concurrent operations, whose token is rejected, renew the token of the shared provider client once.
+// Run with -race to detect unsynchronized accesses to the shared provider client.
+func TestConcurrentOperationsReauthenticateOnce(t *testing.T) {
+	dns := newFakeDns(t, fakeZone{ID: "zone", Name: "example.com."})
+	dns.failWith = func(w http.ResponseWriter, r *http.Request) int {
+		if r.Header.Get("X-Auth-Token") == "token-1" {
+			return http.StatusUnauthorized
+		}
+		return 0
+	}
+	iam := newFakeIam(t, dns)
+
+	otcDnsClient, err := NewDNSV2ClientWithAuth(otc.AuthOptions{
+		IdentityEndpoint: iam.authURL(),
+		Username:         "user",
+		Password:         "password",
+		DomainName:       "domain",
+		TenantID:         "project-id",
+		AllowReauth:      true,
+	}, otc.EndpointOpts{Region: "eu-de"})
+	if err != nil {
+		t.Fatalf("Unable to create client: %v", err)
+	}
+
+	errs := make([]error, 8)
+	var wg sync.WaitGroup
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = otcDnsClient.GetHostedZoneWithContext(context.Background(), "example.com.")
+		}(i)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, 2, iam.getAuthentications())
+	assert.Equal(t, "token-2", otcDnsClient.Sc.ProviderClient.Token())
+}
@@ -0,0 +1,126 @@
+// The tests in this file test the authentication with a pre-issued token against a fake IAM,
+// the expiry of the cached clients with such a token and the classification of the authentication errors.
+package otcdns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	otc "github.com/opentelekomcloud/gophertelekomcloud"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Tests, that an expired token is reported as such.
+func TestNewDNSV2ClientWithExpiredToken(t *testing.T) {
+	iam := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v3/auth/tokens", r.URL.Path)
+		assert.Equal(t, "expired-token", r.Header.Get("X-Subject-Token"))
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"error": {"code": 404, "message": "Could not find token: expired-token"}}`))
+	}))
+	defer iam.Close()
+
+	authOpts := otc.AuthOptions{
+		IdentityEndpoint: iam.URL + "/v3",
+		TokenID:          "expired-token",
+	}
+	_, err := NewDNSV2ClientWithAuth(authOpts, otc.EndpointOpts{Region: "eu-de"})
+	assert.True(t, errors.Is(err, ErrTokenExpired), "An expired token must be reported as such. Got: %v", err)
+}
+
+// Returns a solver with a pre-issued token in a secret and the configuration, that references the token.
+func newSolverWithToken(t *testing.T, iam *fakeIam) (*OtcDnsSolver, *OtcDnsConfig) {
+	solver := newSolverWithSecrets(t, &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "otcdns-token"},
+		Data:       map[string][]byte{"token": []byte("pre-issued-token")},
+	})
+	config := &OtcDnsConfig{
+		AuthURL:        iam.authURL(),
+		Region:         "eu-de",
+		TokenSecretRef: newSecretKeySelector("otcdns-token", "token"),
+	}
+	return solver, config
+}
+
+// Tests, that a cached client with a pre-issued token is validated again, when the token is about to expire.
+func TestCachedClientWithTokenExpires(t *testing.T) {
+	iam := newFakeIam(t, nil)
+	iam.tokenExpiresAt = time.Now().Add(tokenExpiryMargin / 2).Truncate(time.Second)
+	solver, config := newSolverWithToken(t, iam)
+
+	otcDnsClient, err := solver.getOtcDnsClientFromConfig(config, "team-a", false)
+	if err != nil {
+		t.Fatalf("Unable to create client: %v", err)
+	}
+	assert.True(t, iam.tokenExpiresAt.Equal(otcDnsClient.TokenExpiresAt), "The expiry of the validated token must be recorded. Got: %s", otcDnsClient.TokenExpiresAt)
+
+	_, err = solver.getOtcDnsClientFromConfig(config, "team-a", false)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, iam.getAuthentications(), "A token, that is about to expire, must not be cached.")
+}
+
+// Tests, that a token, that the DNS rejects, is reported as expired, and that the client is evicted from the cache.
+func TestTokenRejectedByDns(t *testing.T) {
+	dns := newFakeDns(t, fakeZone{ID: "zone", Name: "example.com."})
+	dns.failWith = func(w http.ResponseWriter, r *http.Request) int {
+		return http.StatusUnauthorized
+	}
+	iam := newFakeIam(t, dns)
+	solver, config := newSolverWithToken(t, iam)
+
+	otcDnsClient, err := solver.getOtcDnsClientFromConfig(config, "team-a", false)
+	if err != nil {
+		t.Fatalf("Unable to create client: %v", err)
+	}
+	_, err = otcDnsClient.GetHostedZoneWithContext(context.Background(), "example.com.")
+	assert.ErrorContains(t, err, ErrTokenExpired.Error(), "A rejected token must be reported as expired.")
+
+	_, err = solver.getOtcDnsClientFromConfig(config, "team-a", false)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, iam.getAuthentications(), "The client with the rejected token must be evicted.")
+}
+
+// Tests, that the DNS rejecting the credentials of a client, that can renew them, is not reported as an expired token.
+func TestCredentialsRejectedByDns(t *testing.T) {
+	dns := newFakeDns(t, fakeZone{ID: "zone", Name: "example.com."})
+	dns.failWith = func(w http.ResponseWriter, r *http.Request) int {
+		return http.StatusUnauthorized
+	}
+	iam := newFakeIam(t, dns)
+	solver := newSolverWithSecrets(t)
+
+	otcDnsClient, err := solver.getOtcDnsClientFromConfig(&OtcDnsConfig{AuthURL: iam.authURL(), Region: "eu-de", AccessKey: "ak", SecretKey: "sk"}, "team-a", false)
+	if err != nil {
+		t.Fatalf("Unable to create client: %v", err)
+	}
+	_, err = otcDnsClient.GetHostedZoneWithContext(context.Background(), "example.com.")
+	assert.Error(t, err)
+	assert.NotContains(t, err.Error(), ErrTokenExpired.Error())
+}
+
+// Tests, which errors are caused by rejected credentials.
+func TestIsAuthenticationError(t *testing.T) {
+	response := func(statusCode int, body string) otc.ErrUnexpectedResponseCode {
+		return otc.ErrUnexpectedResponseCode{Actual: statusCode, Body: []byte(body)}
+	}
+
+	assert.True(t, isAuthenticationError(otc.ErrDefault401{ErrUnexpectedResponseCode: response(http.StatusUnauthorized, "")}))
+	assert.True(t, isAuthenticationError(fmt.Errorf("wrapped: %w", otc.ErrDefault401{})))
+	assert.True(t, isAuthenticationError(&otc.ErrUnableToReauthenticate{}))
+	assert.True(t, isAuthenticationError(otc.ErrDefault403{ErrUnexpectedResponseCode: response(http.StatusForbidden, `{"error_code": "APIGW.0307", "error_msg": "The token must be updated."}`)}),
+		"A 403 with an error code of expired credentials is an authentication error.")
+	assert.True(t, isAuthenticationError(response(http.StatusForbidden, `{"error": {"code": "APIGW.0301", "message": "Incorrect IAM authentication information"}}`)))
+
+	assert.False(t, isAuthenticationError(otc.ErrDefault403{ErrUnexpectedResponseCode: response(http.StatusForbidden, `{"error_code": "DNS.0030", "error_msg": "Policy doesn't allow dns:recordset:create to be performed."}`)}),
+		"A missing permission is not an authentication error.")
+	assert.False(t, isAuthenticationError(otc.ErrDefault403{ErrUnexpectedResponseCode: response(http.StatusForbidden, "Forbidden")}))
+	assert.False(t, isAuthenticationError(errors.New("the certificate has expired")), "The message of an error does not count.")
+	assert.False(t, isAuthenticationError(otc.ErrDefault500{}))
+}
@@ -0,0 +1,244 @@
+package otcdns
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	otc "github.com/opentelekomcloud/gophertelekomcloud"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog"
+)
+
+// ===========================================================================
+// DNS client cache
+// ===========================================================================
+
+const (
+	// Tokens are renewed this long before they expire.
+	tokenExpiryMargin time.Duration = 5 * time.Minute
+)
+
+// Caches the authenticated DNS clients across challenges. An IAM authentication per Present and CleanUp
+// would hit the rate limits of the IAM, when many certificates are renewed at once.
+// The clients are keyed by auth URL, region, project and a fingerprint of the credentials.
+// Rotated credentials get a new key. The entries of the old credentials are evicted, when they are idle,
+// or as soon as a Kubernetes secret they were created from changes.
+type dnsClientCache struct {
+	// A client is authenticated again after this time, before its token expires. OTC tokens are valid for 24 hours at most.
+	refreshAfter time.Duration
+	// A client that has not been used for this time is evicted.
+	idleTimeout time.Duration
+
+	mutex   sync.Mutex
+	entries map[string]*dnsClientCacheEntry
+	// The running authentications by key. Concurrent Gets of the same key wait for them.
+	creating map[string]*dnsClientCreation
+	// The keys of the entries by the "namespace/name" of the Kubernetes secrets they were created from.
+	secretIndex map[string]map[string]struct{}
+}
+
+type dnsClientCacheEntry struct {
+	client    *OtcDnsClient
+	expiresAt time.Time
+	lastUsed  time.Time
+	// The "namespace/name" of the Kubernetes secrets the client was created from.
+	secrets []string
+}
+
+// A running authentication. done is closed, when the client or the error is set.
+type dnsClientCreation struct {
+	done    chan struct{}
+	secrets []string
+	// Set, when a secret changed during the authentication. The client is not cached then.
+	evicted bool
+	client  *OtcDnsClient
+	err     error
+}
+
+func newDnsClientCache(refreshAfter time.Duration, idleTimeout time.Duration) *dnsClientCache {
+	return &dnsClientCache{
+		refreshAfter: refreshAfter,
+		idleTimeout:  idleTimeout,
+		entries:      map[string]*dnsClientCacheEntry{},
+		creating:     map[string]*dnsClientCreation{},
+		secretIndex:  map[string]map[string]struct{}{},
+	}
+}
+
+// Returns the cached client for the given key. The client is created, when there is none or when its token is about to expire.
+// create returns the new client and the time its token expires. A zero time means unknown.
+//
+// The returned client is a copy. The Subdomain can be set per challenge, while the authenticated service client is shared.
+// Concurrent challenges of the same key authenticate only once. They wait for the running authentication and share its result.
+// The cache is not locked during the authentication. Challenges of other keys are not blocked by it.
+func (c *dnsClientCache) Get(key string, create func() (*OtcDnsClient, time.Time, error)) (*OtcDnsClient, error) {
+	return c.GetForSecrets(key, nil, create)
+}
+
+// Returns the cached client for the given key like Get.
+// secrets are the "namespace/name" of the Kubernetes secrets the credentials were loaded from. See EvictSecret.
+func (c *dnsClientCache) GetForSecrets(key string, secrets []string, create func() (*OtcDnsClient, time.Time, error)) (*OtcDnsClient, error) {
+	if c == nil {
+		// Without a cache every client is authenticated.
+		client, _, err := create()
+		return client, err
+	}
+
+	c.mutex.Lock()
+	now := time.Now()
+	c.evictIdleLocked(now)
+
+	if entry, ok := c.entries[key]; ok && now.Before(entry.expiresAt) {
+		entry.lastUsed = now
+		client := *entry.client
+		c.mutex.Unlock()
+		return &client, nil
+	}
+	if creation, ok := c.creating[key]; ok {
+		c.mutex.Unlock()
+		<-creation.done
+		if creation.err != nil {
+			return nil, creation.err
+		}
+		client := *creation.client
+		return &client, nil
+	}
+	creation := &dnsClientCreation{done: make(chan struct{}), secrets: secrets}
+	c.creating[key] = creation
+	c.mutex.Unlock()
+
+	client, tokenExpiresAt, err := create()
+
+	c.mutex.Lock()
+	delete(c.creating, key)
+	c.deleteLocked(key)
+	if err == nil && !creation.evicted {
+		now = time.Now()
+		expiresAt := now.Add(c.refreshAfter)
+		if !tokenExpiresAt.IsZero() && tokenExpiresAt.Add(-tokenExpiryMargin).Before(expiresAt) {
+			expiresAt = tokenExpiresAt.Add(-tokenExpiryMargin)
+		}
+		entry := &dnsClientCacheEntry{client: client, expiresAt: expiresAt, lastUsed: now, secrets: secrets}
+		client.onTokenRejected = func() { c.evictEntry(key, entry) }
+		c.entries[key] = entry
+		for _, secret := range secrets {
+			if c.secretIndex[secret] == nil {
+				c.secretIndex[secret] = map[string]struct{}{}
+			}
+			c.secretIndex[secret][key] = struct{}{}
+		}
+		klog.V(4).Infof("created DNS client %s. It is authenticated again at %s", shortKey(key), expiresAt)
+	}
+	creation.client, creation.err = client, err
+	c.mutex.Unlock()
+	close(creation.done)
+
+	if err != nil {
+		return nil, err
+	}
+	clientCopy := *client
+	return &clientCopy, nil
+}
+
+// Evicts the clients that have been idle for longer than the idle timeout.
+func (c *dnsClientCache) EvictIdle() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.evictIdleLocked(time.Now())
+}
+
+func (c *dnsClientCache) evictIdleLocked(now time.Time) {
+	for key, entry := range c.entries {
+		if now.Sub(entry.lastUsed) > c.idleTimeout {
+			c.deleteLocked(key)
+			klog.V(4).Infof("evicted idle DNS client %s", shortKey(key))
+		}
+	}
+}
+
+// Evicts the clients, that were created from the Kubernetes secret with the given namespace and name.
+// The next challenge authenticates again with the changed secret.
+func (c *dnsClientCache) EvictSecret(namespace string, name string) {
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	secret := namespace + "/" + name
+	for key := range c.secretIndex[secret] {
+		c.deleteLocked(key)
+		klog.V(4).Infof("evicted DNS client %s. Secret %s changed", shortKey(key), secret)
+	}
+	for _, creation := range c.creating {
+		for _, creationSecret := range creation.secrets {
+			if creationSecret == secret {
+				creation.evicted = true
+			}
+		}
+	}
+}
+
+// Evicts the given entry, e.g. because the API rejected its token. A newer entry of the key is kept.
+func (c *dnsClientCache) evictEntry(key string, entry *dnsClientCacheEntry) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.entries[key] == entry {
+		c.deleteLocked(key)
+		klog.V(4).Infof("evicted DNS client %s. Its token was rejected", shortKey(key))
+	}
+}
+
+// Removes the entry with the given key and its secrets from the index.
+// Must be called with the mutex held.
+func (c *dnsClientCache) deleteLocked(key string) {
+	entry, ok := c.entries[key]
+	if !ok {
+		return
+	}
+	delete(c.entries, key)
+	for _, secret := range entry.secrets {
+		delete(c.secretIndex[secret], key)
+		if len(c.secretIndex[secret]) == 0 {
+			delete(c.secretIndex, secret)
+		}
+	}
+}
+
+// Evicts the idle clients periodically until the stop channel is closed.
+func (c *dnsClientCache) Run(stopCh <-chan struct{}) {
+	wait.Until(c.EvictIdle, c.idleTimeout, stopCh)
+}
+
+// Builds the cache key of a client. The credentials only enter the key as a fingerprint.
+func dnsClientCacheKey(authURL string, region string, project string, credentials ...interface{}) string {
+	fingerprint := sha256.New()
+	for _, credential := range credentials {
+		fmt.Fprintf(fingerprint, "%#v\n", credential)
+	}
+	return strings.Join([]string{authURL, region, project, hex.EncodeToString(fingerprint.Sum(nil))}, "|")
+}
+
+// Builds the cache key of a client from the auth options and the endpoint options.
+func dnsClientCacheKeyFromAuthOptions(authOpts otc.AuthOptionsProvider, endpointOpts otc.EndpointOpts) string {
+	project := ""
+	switch opts := authOpts.(type) {
+	case otc.AuthOptions:
+		project = opts.TenantID + "/" + opts.TenantName + "/" + opts.DelegatedProject
+	case otc.AKSKAuthOptions:
+		project = opts.ProjectId + "/" + opts.ProjectName + "/" + opts.DelegatedProject
+	}
+	return dnsClientCacheKey(authOpts.GetIdentityEndpoint(), endpointOpts.Region, project, authOpts, endpointOpts)
+}
+
+// Shortens the key for the log. The fingerprint is not logged.
+func shortKey(key string) string {
+	if i := strings.LastIndex(key, "|"); i >= 0 {
+		return key[:i]
+	}
+	return key
+}
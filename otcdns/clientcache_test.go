@@ -0,0 +1,236 @@
+// The tests in this file test the cache of the authenticated DNS clients.
+package otcdns
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	cmmeta1 "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	otc "github.com/opentelekomcloud/gophertelekomcloud"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// Returns a create function, that counts the created clients and returns clients with the given token expiry.
+func newCountingClientFactory(calls *int, tokenExpiresAt time.Time) func() (*OtcDnsClient, time.Time, error) {
+	return func() (*OtcDnsClient, time.Time, error) {
+		*calls++
+		return &OtcDnsClient{ProjectID: fmt.Sprintf("project-%d", *calls)}, tokenExpiresAt, nil
+	}
+}
+
+// Tests, if a client is reused and each caller gets its own copy.
+func TestDnsClientCacheReusesClients(t *testing.T) {
+	cache := newDnsClientCache(time.Hour, time.Hour)
+	calls := 0
+
+	client1, err := cache.Get("key", newCountingClientFactory(&calls, time.Time{}))
+	assert.NoError(t, err)
+	client1.Subdomain = "_acme-challenge.www"
+	client2, err := cache.Get("key", newCountingClientFactory(&calls, time.Time{}))
+	assert.NoError(t, err)
+
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, "project-1", client2.ProjectID)
+	assert.Empty(t, client2.Subdomain, "the subdomain of a challenge must not leak into the cached client")
+
+	_, err = cache.Get("other-key", newCountingClientFactory(&calls, time.Time{}))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, calls)
+}
+
+// Tests, if a client is authenticated again after the refresh interval and before its token expires.
+func TestDnsClientCacheRefreshesClients(t *testing.T) {
+	cache := newDnsClientCache(time.Hour, time.Hour)
+	calls := 0
+
+	_, err := cache.Get("key", newCountingClientFactory(&calls, time.Time{}))
+	assert.NoError(t, err)
+	cache.entries["key"].expiresAt = time.Now().Add(-time.Second)
+	client, err := cache.Get("key", newCountingClientFactory(&calls, time.Time{}))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, calls)
+	assert.Equal(t, "project-2", client.ProjectID)
+
+	// A token, that expires within the margin, is renewed with the next call.
+	_, err = cache.Get("expiring-key", newCountingClientFactory(&calls, time.Now().Add(tokenExpiryMargin/2)))
+	assert.NoError(t, err)
+	_, err = cache.Get("expiring-key", newCountingClientFactory(&calls, time.Now().Add(time.Hour)))
+	assert.NoError(t, err)
+	assert.Equal(t, 4, calls)
+	assert.WithinDuration(t, time.Now().Add(time.Hour-tokenExpiryMargin), cache.entries["expiring-key"].expiresAt, time.Minute)
+}
+
+// Tests, if failed authentications are not cached.
+func TestDnsClientCacheDoesNotCacheErrors(t *testing.T) {
+	cache := newDnsClientCache(time.Hour, time.Hour)
+
+	_, err := cache.Get("key", func() (*OtcDnsClient, time.Time, error) {
+		return nil, time.Time{}, fmt.Errorf("authentication failed")
+	})
+	assert.Error(t, err)
+	assert.Empty(t, cache.entries)
+}
+
+// Tests, if idle clients are evicted.
+func TestDnsClientCacheEvictsIdleClients(t *testing.T) {
+	cache := newDnsClientCache(time.Hour, time.Minute)
+	calls := 0
+
+	_, err := cache.Get("idle-key", newCountingClientFactory(&calls, time.Time{}))
+	assert.NoError(t, err)
+	_, err = cache.Get("used-key", newCountingClientFactory(&calls, time.Time{}))
+	assert.NoError(t, err)
+	cache.entries["idle-key"].lastUsed = time.Now().Add(-2 * time.Minute)
+
+	cache.EvictIdle()
+	assert.NotContains(t, cache.entries, "idle-key")
+	assert.Contains(t, cache.entries, "used-key")
+}
+
+// Tests, if rotated credentials get a new key and the key does not contain the credentials.
+func TestDnsClientCacheKeyFromAuthOptions(t *testing.T) {
+	endpointOpts := otc.EndpointOpts{Region: "eu-de"}
+	authOpts := otc.AKSKAuthOptions{IdentityEndpoint: "https://iam.eu-de.otc.t-systems.com/v3", ProjectId: "project", AccessKey: "ak", SecretKey: "sk-1"}
+	key := dnsClientCacheKeyFromAuthOptions(authOpts, endpointOpts)
+
+	assert.Equal(t, key, dnsClientCacheKeyFromAuthOptions(authOpts, endpointOpts))
+	assert.NotContains(t, key, "sk-1")
+
+	authOpts.SecretKey = "sk-2"
+	assert.NotEqual(t, key, dnsClientCacheKeyFromAuthOptions(authOpts, endpointOpts))
+	assert.NotEqual(t, key, dnsClientCacheKeyFromAuthOptions(authOpts, otc.EndpointOpts{Region: "eu-nl"}))
+}
+
+// Tests, if the clients are evicted, when a secret they were created from changes.
+func TestDnsClientCacheEvictSecret(t *testing.T) {
+	cache := newDnsClientCache(time.Hour, time.Hour)
+	calls := 0
+
+	_, err := cache.GetForSecrets("key", []string{"team-a/otcdns-credentials"}, newCountingClientFactory(&calls, time.Time{}))
+	assert.NoError(t, err)
+	_, err = cache.GetForSecrets("other-key", []string{"team-b/otcdns-credentials"}, newCountingClientFactory(&calls, time.Time{}))
+	assert.NoError(t, err)
+
+	cache.EvictSecret("team-a", "otcdns-credentials")
+	assert.NotContains(t, cache.entries, "key")
+	assert.Contains(t, cache.entries, "other-key")
+	assert.NotContains(t, cache.secretIndex, "team-a/otcdns-credentials")
+
+	cache.EvictIdle()
+	cache.entries["other-key"].lastUsed = time.Now().Add(-2 * time.Hour)
+	cache.EvictIdle()
+	assert.Empty(t, cache.secretIndex, "Evicted entries must be removed from the secret index.")
+}
+
+// Tests, that a rotated Kubernetes secret forces a new authentication, even if the credentials it holds did not change.
+func TestSolverReauthenticatesOnSecretRotation(t *testing.T) {
+	iam := newFakeIam(t, nil)
+	client := fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "otcdns-credentials"},
+		Data:       map[string][]byte{"accessKey": []byte("ak"), "secretKey": []byte("sk")},
+	})
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+
+	solver := NewSolver().(*OtcDnsSolver)
+	solver.secrets = newSecretCache(client, stopCh)
+	solver.secrets.OnChange(solver.onSecretChange)
+	config := &OtcDnsConfig{
+		AuthURL:            iam.authURL(),
+		Region:             "eu-de",
+		ProjectID:          "project-id",
+		AccessKeySecretRef: newSecretKeySelector("otcdns-credentials", "accessKey"),
+		SecretKeySecretRef: newSecretKeySelector("otcdns-credentials", "secretKey"),
+	}
+
+	for i := 0; i < 2; i++ {
+		_, err := solver.getOtcDnsClientFromConfig(config, "team-a", false)
+		if err != nil {
+			t.Fatalf("Unable to create client: %v", err)
+		}
+	}
+	assert.Equal(t, 1, iam.getAuthentications(), "The client must be reused.")
+
+	_, err := client.CoreV1().Secrets("team-a").Update(context.Background(), &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "otcdns-credentials"},
+		Data:       map[string][]byte{"accessKey": []byte("ak"), "secretKey": []byte("sk"), "rotatedAt": []byte("now")},
+	}, metav1.UpdateOptions{})
+	if err != nil {
+		t.Fatalf("Unable to update secret: %v", err)
+	}
+	assert.Eventually(t, func() bool {
+		solver.clients.mutex.Lock()
+		defer solver.clients.mutex.Unlock()
+		return len(solver.clients.entries) == 0
+	}, 5*time.Second, 10*time.Millisecond, "The client of the rotated secret must be evicted.")
+
+	_, err = solver.getOtcDnsClientFromConfig(config, "team-a", false)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, iam.getAuthentications(), "The rotation must force a new authentication.")
+}
+
+// Returns a reference to the given key of the secret with the given name in the resource namespace.
+func newSecretKeySelector(name string, key string) SecretKeySelector {
+	return SecretKeySelector{SecretKeySelector: cmmeta1.SecretKeySelector{LocalObjectReference: cmmeta1.LocalObjectReference{Name: name}, Key: key}}
+}
+
+// Tests, if concurrent Gets of the same key authenticate once, while the Gets of other keys are not blocked.
+func TestDnsClientCacheConcurrentCreation(t *testing.T) {
+	cache := newDnsClientCache(time.Hour, time.Hour)
+	release := make(chan struct{})
+	var calls int32
+	slowCreate := func() (*OtcDnsClient, time.Time, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return &OtcDnsClient{ProjectID: "slow"}, time.Time{}, nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			client, err := cache.Get("slow-key", slowCreate)
+			if assert.NoError(t, err) {
+				assert.Equal(t, "slow", client.ProjectID)
+			}
+		}()
+	}
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&calls) == 1 }, time.Second, time.Millisecond)
+
+	otherCalls := 0
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, err := cache.Get("other-key", newCountingClientFactory(&otherCalls, time.Time{}))
+		assert.NoError(t, err)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("A running authentication must not block the clients of other keys.")
+	}
+
+	close(release)
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls), "Concurrent Gets of the same key must authenticate once.")
+}
+
+// Tests, that a client is not cached, when its secret changed during the authentication.
+func TestDnsClientCacheEvictSecretDuringCreation(t *testing.T) {
+	cache := newDnsClientCache(time.Hour, time.Hour)
+
+	_, err := cache.GetForSecrets("key", []string{"team-a/otcdns-credentials"}, func() (*OtcDnsClient, time.Time, error) {
+		cache.EvictSecret("team-a", "otcdns-credentials")
+		return &OtcDnsClient{}, time.Time{}, nil
+	})
+	assert.NoError(t, err)
+	assert.Empty(t, cache.entries)
+}
@@ -3,9 +3,16 @@ package otcdns
 import (
 	"encoding/json"
 	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	otc "github.com/opentelekomcloud/gophertelekomcloud"
 	otcos "github.com/opentelekomcloud/gophertelekomcloud/openstack"
+	otcutils "github.com/opentelekomcloud/gophertelekomcloud/openstack/utils"
+	"gopkg.in/yaml.v2"
 	extapi "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 
 	cmmeta1 "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
@@ -41,15 +48,117 @@ type OtcDnsConfig struct {
 	// Especially useful until it becomes clear how to inject secrets in kubebuilder.
 	SecretKey string `json:"secretKey"`
 	// Location of the access key secret. The access key will be loaded from this secret reference.
-	AccessKeySecretRef cmmeta1.SecretKeySelector `json:"accessKeySecretRef"`
+	AccessKeySecretRef SecretKeySelector `json:"accessKeySecretRef"`
 	// Location of the secret key secret.  The secret key will be loaded from this secret reference.
-	SecretKeySecretRef cmmeta1.SecretKeySelector `json:"secretKeySecretRef"`
+	SecretKeySecretRef SecretKeySelector `json:"secretKeySecretRef"`
+	// Optional location of the security token secret. Temporary AK/SK credentials issued by the IAM come with a security token.
+	// It is only valid together with the access key and secret key it was issued with.
+	SecurityTokenSecretRef SecretKeySelector `json:"securityTokenSecretRef"`
+	// Selects where the credentials are loaded from: "kubernetes" (default), "file", "env", "exec", "csms", "metadata"
+	// or the name of a provider registered with NewSolverWithCredentialProviders.
+	CredentialProvider string `json:"credentialProvider"`
+	// Optional arguments of the credential provider. The exec provider passes them to the plugin.
+	CredentialProviderArgs map[string]string `json:"credentialProviderArgs"`
+	// The JSON file the "file" credential provider loads the credentials from.
+	// It must be located in a directory allowed with CREDENTIAL_FILE_DIRS.
+	CredentialsFile string `json:"credentialsFile"`
+	// Files in the webhook container the "file" credential provider loads the credentials from, e.g. secrets mounted
+	// by a secrets-store CSI driver. They must be located in a directory allowed with CREDENTIAL_FILE_DIRS.
+	// The files are read again, when they change on disk.
+	AccessKeyFile string `json:"accessKeyFile"`
+	SecretKeyFile string `json:"secretKeyFile"`
+	// Optional security token of temporary AK/SK credentials.
+	SecurityTokenFile string `json:"securityTokenFile"`
+	// Optional pre-issued IAM token. It replaces the access key and the secret key.
+	TokenFile string `json:"tokenFile"`
+	// The name of a secret in the OTC Cloud Secret Management Service (CSMS) with the credentials as JSON.
+	// The secret is read with the bootstrap identity of the webhook. This selects the "csms" credential provider.
+	CsmsSecretName string `json:"csmsSecretName"`
+	// The version of the CSMS secret. Defaults to "latest".
+	CsmsSecretVersion string `json:"csmsSecretVersion"`
+	// The authentication method used against the OTC IAM. Either "aksk" (default), "password" or "oidc".
+	AuthType string `json:"authType"`
+	// Location of the IAM username secret. Only used with authType "password".
+	UsernameSecretRef SecretKeySelector `json:"usernameSecretRef"`
+	// Location of the IAM password secret. Only used with authType "password".
+	PasswordSecretRef SecretKeySelector `json:"passwordSecretRef"`
+	// Location of the IAM domain name secret. The domain the IAM user belongs to. Only used with authType "password".
+	DomainNameSecretRef SecretKeySelector `json:"domainNameSecretRef"`
+	// Optional location of the project ID secret. When set, the token is scoped to this project. Only used with authType "password".
+	ProjectIDSecretRef SecretKeySelector `json:"projectIDSecretRef"`
+	// Optional location of a secret that holds a complete clouds.yaml. The credentials, the auth URL and the region are
+	// taken from the cloud selected by cloudsProfile. This replaces the other credential references.
+	CloudsYamlSecretRef SecretKeySelector `json:"cloudsYamlSecretRef"`
+	// The name of the cloud in the clouds.yaml, e.g. "otcaksk" or "otcuser".
+	// It can be omitted, when the clouds.yaml contains exactly one cloud.
+	CloudsProfile string `json:"cloudsProfile"`
+	// Optional location of a pre-issued, scoped IAM token (X-Auth-Token). The DNS client is built from this token.
+	// This replaces the other credential references. The token must be replaced before it expires.
+	TokenSecretRef SecretKeySelector `json:"tokenSecretRef"`
+	// Optional ID of the project the token is scoped to. Zones owned by a project (e.g. private zones)
+	// can only be managed with a project scoped token. Without a project the token is scoped to the domain.
+	ProjectID string `json:"projectID"`
+	// Optional name of the project the token is scoped to (e.g. "eu-de_dns"). Used when projectID is not set.
+	ProjectName string `json:"projectName"`
+	// Optional name of an IAM agency to assume. The webhook authenticates with its own credentials first.
+	// The zones and recordsets are then managed with the delegated token of the agency.
+	AgencyName string `json:"agencyName"`
+	// The name of the domain (account) that created the agency. Required with agencyName.
+	AgencyDomainName string `json:"agencyDomainName"`
+	// Optional name of the project in the agency domain the delegated token is scoped to.
+	// Without a project the delegated token is scoped to the agency domain.
+	DelegatedProject string `json:"delegatedProject"`
+	// The name of the domain the AK/SK credentials belong to. Required to assume an agency with authType "aksk".
+	DomainName string `json:"domainName"`
+	// The ID of the OpenID Connect identity provider in the IAM the service account token of the webhook is exchanged with.
+	// Only used with authType "oidc".
+	IdentityProviderID string `json:"identityProviderID"`
+	// Optional ID of the domain the exchanged token is scoped to, when neither projectID nor projectName is set.
+	// Only used with authType "oidc".
+	DomainID string `json:"domainID"`
+	// Optional zone the preflight check creates and deletes a test recordset in (e.g. "example.com.").
+	// Without a zone the preflight check only authenticates and lists the zones.
+	PreflightZone string `json:"preflightZone"`
+	// How the hosted zone of a challenge is found: "resolvedZone" (default) uses the zone cert-manager resolved.
+	// "longestSuffix" uses the deepest zone hosted in the account, that contains the challenge FQDN.
+	ZoneDiscovery string `json:"zoneDiscovery"`
+	// The type of the zones the challenges are solved in: "public" (default), "private" or "both".
+	// An account can host a public and a private zone with the same name. "both" requires the name to be unique.
+	ZoneType string `json:"zoneType"`
+	// Optional ID of the router (VPC) the private zone is associated with. Selects among private zones with the same name.
+	RouterID string `json:"routerID"`
+	// Optional ID of the zone the challenges are solved in. The zone is fetched by its ID instead of being looked up by name.
+	// The challenge FQDN must be inside the zone. zoneDiscovery, zoneType and routerID are not used then.
+	ZoneID string `json:"zoneID"`
+	// The TTL of the challenge recordsets in seconds. 300 by default.
+	TTL int `json:"ttl"`
+	// Optional text/template of the description of the challenge recordsets.
+	// It can use {{ .Namespace }}, {{ .ClusterName }} and {{ .FQDN }}. "ACME Challenge" by default.
+	DescriptionTemplate string `json:"descriptionTemplate"`
 	//
 	Region string `json:"region"`
 	//
 	AuthURL string `json:"authURL"`
 }
 
+// SecretKeySelector references a key of a Secret.
+// In addition to the cert-manager selector it can name the namespace of the Secret.
+type SecretKeySelector struct {
+	cmmeta1.SecretKeySelector `json:",inline"`
+	// Optional namespace of the secret. Defaults to the resource namespace of the challenge.
+	// This is the namespace of the Issuer or the cluster resource namespace of cert-manager for a ClusterIssuer.
+	// Only ClusterIssuers may reference other namespaces. They must be allowed with SECRET_NAMESPACES.
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// The authentication methods that can be selected with OtcDnsConfig.AuthType.
+const (
+	AuthTypeAkSk     string = "aksk"
+	AuthTypePassword string = "password"
+	// Exchanges the projected service account token of the webhook for an IAM token. No OTC keys are stored in Kubernetes.
+	AuthTypeOIDC string = "oidc"
+)
+
 // The "config" part of the solver configuration is given to us with the ChallengeRequest
 // in a plain json format.
 // We unmarshal that json here and integrate it into our OtcDnsConfig object.
@@ -69,6 +178,360 @@ func configJsonToOtcDnsConfig(cfgJSON *extapi.JSON) (OtcDnsConfig, error) {
 	return cfg, nil
 }
 
+// Tests, if the configuration references any credentials.
+// A configuration without credentials asks for the ambient credentials of the webhook.
+func (cfg *OtcDnsConfig) hasCredentials() bool {
+	return cfg.AccessKey != "" ||
+		cfg.SecretKey != "" ||
+		cfg.AccessKeySecretRef.Name != "" ||
+		cfg.SecretKeySecretRef.Name != "" ||
+		cfg.SecurityTokenSecretRef.Name != "" ||
+		cfg.UsernameSecretRef.Name != "" ||
+		cfg.PasswordSecretRef.Name != "" ||
+		cfg.DomainNameSecretRef.Name != "" ||
+		cfg.ProjectIDSecretRef.Name != "" ||
+		cfg.CloudsYamlSecretRef.Name != "" ||
+		cfg.TokenSecretRef.Name != "" ||
+		cfg.CredentialProvider != "" ||
+		cfg.CsmsSecretName != "" ||
+		cfg.hasCredentialFiles()
+}
+
+// Tests, if the configuration references files with credentials.
+func (cfg *OtcDnsConfig) hasCredentialFiles() bool {
+	return cfg.CredentialsFile != "" ||
+		cfg.AccessKeyFile != "" ||
+		cfg.SecretKeyFile != "" ||
+		cfg.SecurityTokenFile != "" ||
+		cfg.TokenFile != ""
+}
+
+// ===========================================================================
+// Webhook configuration (Environment)
+// ===========================================================================
+
+const (
+	// Comma separated list of the namespaces the secret references of ClusterIssuers may point to,
+	// in addition to the resource namespace of the challenge.
+	envSecretNamespaces string = "SECRET_NAMESPACES"
+	// The API group of the webhook. The Issuers and ClusterIssuers reference the webhook with it.
+	envGroupName string = "GROUP_NAME"
+	// The namespace cert-manager loads the secrets of ClusterIssuers from (--cluster-resource-namespace).
+	envClusterResourceNamespace string = "CLUSTER_RESOURCE_NAMESPACE"
+	// The name of the cluster the webhook runs in. The description templates of the challenge recordsets can use it.
+	envClusterName string = "CLUSTER_NAME"
+	// The ID of the cluster the webhook runs in. The challenge recordsets are tagged with it. CLUSTER_NAME by default.
+	envClusterID string = "CLUSTER_ID"
+	// How often the solver configurations of the Issuers and ClusterIssuers are checked, e.g. "1h". "0" disables the check.
+	envPreflightInterval string = "PREFLIGHT_INTERVAL"
+	// The name of the pod of the webhook. It is part of the name of the test recordsets of the preflight check.
+	envPodName string = "POD_NAME"
+
+	// The projected service account token of the webhook, that is exchanged for an IAM token with authType "oidc".
+	envIdTokenFile string = "OIDC_TOKEN_FILE"
+
+	// Comma separated list of the directories the "file" credential provider may read from.
+	envCredentialFileDirs string = "CREDENTIAL_FILE_DIRS"
+	// The command of the "exec" credential provider, e.g. "/usr/local/bin/otc-broker --format json".
+	envCredentialExecCommand string = "CREDENTIAL_EXEC_COMMAND"
+	// The endpoint of the Cloud Secret Management Service. A %s is replaced with the region of the solver configuration.
+	envCsmsEndpoint string = "CSMS_ENDPOINT"
+	// How long the credentials read from the Cloud Secret Management Service are cached, e.g. "5m".
+	envCsmsCacheTTL string = "CSMS_CACHE_TTL"
+	// The endpoint of the ECS metadata service the "metadata" credential provider fetches the temporary credentials from.
+	envMetadataEndpoint string = "METADATA_ENDPOINT"
+
+	// How long an authenticated DNS client is reused, before it is authenticated again, e.g. "1h".
+	envDnsClientRefreshAfter string = "DNS_CLIENT_REFRESH_AFTER"
+	// How long an unused DNS client is kept, e.g. "30m".
+	envDnsClientIdleTimeout string = "DNS_CLIENT_IDLE_TIMEOUT"
+	// The timeouts of the DNS operations, e.g. "30s". "0" disables the timeout.
+	envDnsReadTimeout   string = "DNS_READ_TIMEOUT"
+	envDnsCreateTimeout string = "DNS_CREATE_TIMEOUT"
+	envDnsUpdateTimeout string = "DNS_UPDATE_TIMEOUT"
+	envDnsDeleteTimeout string = "DNS_DELETE_TIMEOUT"
+	// How often a failed DNS request is retried. "0" disables the retries.
+	envDnsMaxRetries string = "DNS_MAX_RETRIES"
+	// The backoff before the first retry and the upper limit of the backoff, e.g. "1s" and "30s".
+	envDnsRetryInitialBackoff string = "DNS_RETRY_INITIAL_BACKOFF"
+	envDnsRetryMaxBackoff     string = "DNS_RETRY_MAX_BACKOFF"
+	// The total time a DNS operation may spend including its retries, e.g. "2m". "0" means no limit.
+	envDnsRetryBudget string = "DNS_RETRY_BUDGET"
+	// The requests per second and the burst of the DNS requests of each OTC account. A rate of "0" disables the limit.
+	envDnsRateLimitQPS   string = "DNS_RATE_LIMIT_QPS"
+	envDnsRateLimitBurst string = "DNS_RATE_LIMIT_BURST"
+	// How long the changes of recordsets are awaited to become ACTIVE or deleted, e.g. "2m". "0" disables the waiting.
+	envDnsStatusWaitTimeout string = "DNS_STATUS_WAIT_TIMEOUT"
+	// The time between two polls of the status of a recordset, e.g. "2s".
+	envDnsStatusPollInterval string = "DNS_STATUS_POLL_INTERVAL"
+
+	defaultGroupName                string        = "infra-otc-cert-manager-webhook.hpi-schul-cloud.github.com"
+	defaultClusterResourceNamespace string        = "cert-manager"
+	defaultPreflightInterval        time.Duration = time.Hour
+	defaultIdTokenFile              string        = "/var/run/secrets/tokens/otc-token"
+	defaultCsmsEndpoint             string        = "https://kms.%s.otc.t-systems.com"
+	defaultCsmsCacheTTL             time.Duration = 5 * time.Minute
+	defaultMetadataEndpoint         string        = "http://169.254.169.254"
+	defaultDnsClientRefreshAfter    time.Duration = time.Hour
+	defaultDnsClientIdleTimeout     time.Duration = 30 * time.Minute
+	defaultDnsOperationTimeout      time.Duration = 30 * time.Second
+	defaultDnsMaxRetries            int           = 3
+	defaultDnsRetryInitialBackoff   time.Duration = time.Second
+	defaultDnsRetryMaxBackoff       time.Duration = 30 * time.Second
+	defaultDnsRetryBudget           time.Duration = 2 * time.Minute
+	defaultDnsRateLimitQPS          float64       = 10
+	defaultDnsRateLimitBurst        int           = 20
+	defaultDnsStatusWaitTimeout     time.Duration = 2 * time.Minute
+	defaultDnsStatusPollInterval    time.Duration = 2 * time.Second
+)
+
+// Loads the namespaces the secret references may point to from the environment.
+func getAllowedSecretNamespaces() []string {
+	var namespaces []string
+	for _, namespace := range strings.Split(os.Getenv(envSecretNamespaces), ",") {
+		namespace = strings.TrimSpace(namespace)
+		if namespace != "" {
+			namespaces = append(namespaces, namespace)
+		}
+	}
+	return namespaces
+}
+
+// Loads the directories the "file" credential provider may read from the environment.
+func getCredentialFileDirs() []string {
+	var dirs []string
+	for _, dir := range strings.Split(os.Getenv(envCredentialFileDirs), ",") {
+		dir = strings.TrimSpace(dir)
+		if dir != "" {
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+// Loads the command of the "exec" credential provider from the environment.
+func getCredentialExecCommand() []string {
+	return strings.Fields(os.Getenv(envCredentialExecCommand))
+}
+
+// Loads the endpoint of the Cloud Secret Management Service from the environment.
+func getCsmsEndpoint() string {
+	if os.Getenv(envCsmsEndpoint) == "" {
+		return defaultCsmsEndpoint
+	}
+	return os.Getenv(envCsmsEndpoint)
+}
+
+// Loads how long the credentials read from the Cloud Secret Management Service are cached from the environment.
+func getCsmsCacheTTL() (time.Duration, error) {
+	if os.Getenv(envCsmsCacheTTL) == "" {
+		return defaultCsmsCacheTTL, nil
+	}
+	ttl, err := time.ParseDuration(os.Getenv(envCsmsCacheTTL))
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %s", envCsmsCacheTTL, err)
+	}
+	return ttl, nil
+}
+
+// Loads how long an authenticated DNS client is reused from the environment.
+func getDnsClientRefreshAfter() (time.Duration, error) {
+	return getPositiveDuration(envDnsClientRefreshAfter, defaultDnsClientRefreshAfter)
+}
+
+// Loads how long an unused DNS client is kept from the environment.
+func getDnsClientIdleTimeout() (time.Duration, error) {
+	return getPositiveDuration(envDnsClientIdleTimeout, defaultDnsClientIdleTimeout)
+}
+
+// Loads the timeouts of the DNS operations from the environment.
+func getDnsOperationTimeouts() (OperationTimeouts, error) {
+	var timeouts OperationTimeouts
+	for _, timeout := range []struct {
+		env      string
+		duration *time.Duration
+	}{
+		{envDnsReadTimeout, &timeouts.Read},
+		{envDnsCreateTimeout, &timeouts.Create},
+		{envDnsUpdateTimeout, &timeouts.Update},
+		{envDnsDeleteTimeout, &timeouts.Delete},
+	} {
+		*timeout.duration = defaultDnsOperationTimeout
+		if os.Getenv(timeout.env) == "" {
+			continue
+		}
+		duration, err := time.ParseDuration(os.Getenv(timeout.env))
+		if err != nil || duration < 0 {
+			return OperationTimeouts{}, fmt.Errorf("invalid %s: %q", timeout.env, os.Getenv(timeout.env))
+		}
+		*timeout.duration = duration
+	}
+	return timeouts, nil
+}
+
+// The retry policy, that is used, when the environment configures none.
+func getDefaultDnsRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxRetries:     defaultDnsMaxRetries,
+		InitialBackoff: defaultDnsRetryInitialBackoff,
+		MaxBackoff:     defaultDnsRetryMaxBackoff,
+		Budget:         defaultDnsRetryBudget,
+	}
+}
+
+// Loads the retry policy of the DNS operations from the environment.
+func getDnsRetryPolicy() (RetryPolicy, error) {
+	policy := getDefaultDnsRetryPolicy()
+	if os.Getenv(envDnsMaxRetries) != "" {
+		maxRetries, err := strconv.Atoi(os.Getenv(envDnsMaxRetries))
+		if err != nil || maxRetries < 0 {
+			return RetryPolicy{}, fmt.Errorf("invalid %s: %q", envDnsMaxRetries, os.Getenv(envDnsMaxRetries))
+		}
+		policy.MaxRetries = maxRetries
+	}
+	for _, duration := range []struct {
+		env   string
+		value *time.Duration
+	}{
+		{envDnsRetryInitialBackoff, &policy.InitialBackoff},
+		{envDnsRetryMaxBackoff, &policy.MaxBackoff},
+		{envDnsRetryBudget, &policy.Budget},
+	} {
+		if os.Getenv(duration.env) == "" {
+			continue
+		}
+		value, err := time.ParseDuration(os.Getenv(duration.env))
+		if err != nil || value < 0 {
+			return RetryPolicy{}, fmt.Errorf("invalid %s: %q", duration.env, os.Getenv(duration.env))
+		}
+		*duration.value = value
+	}
+	return policy, nil
+}
+
+// Loads the rate limit of the DNS requests of each OTC account from the environment.
+func getDnsRateLimit() (float64, int, error) {
+	qps := defaultDnsRateLimitQPS
+	if os.Getenv(envDnsRateLimitQPS) != "" {
+		var err error
+		qps, err = strconv.ParseFloat(os.Getenv(envDnsRateLimitQPS), 64)
+		if err != nil || qps < 0 {
+			return 0, 0, fmt.Errorf("invalid %s: %q", envDnsRateLimitQPS, os.Getenv(envDnsRateLimitQPS))
+		}
+	}
+	burst := defaultDnsRateLimitBurst
+	if os.Getenv(envDnsRateLimitBurst) != "" {
+		var err error
+		burst, err = strconv.Atoi(os.Getenv(envDnsRateLimitBurst))
+		if err != nil || burst < 1 {
+			return 0, 0, fmt.Errorf("invalid %s: %q", envDnsRateLimitBurst, os.Getenv(envDnsRateLimitBurst))
+		}
+	}
+	return qps, burst, nil
+}
+
+// Loads how long the changes of recordsets are awaited from the environment.
+func getDnsStatusWaitPolicy() (StatusWaitPolicy, error) {
+	policy := StatusWaitPolicy{Timeout: defaultDnsStatusWaitTimeout, PollInterval: defaultDnsStatusPollInterval}
+	if os.Getenv(envDnsStatusWaitTimeout) != "" {
+		timeout, err := time.ParseDuration(os.Getenv(envDnsStatusWaitTimeout))
+		if err != nil || timeout < 0 {
+			return StatusWaitPolicy{}, fmt.Errorf("invalid %s: %q", envDnsStatusWaitTimeout, os.Getenv(envDnsStatusWaitTimeout))
+		}
+		policy.Timeout = timeout
+	}
+	pollInterval, err := getPositiveDuration(envDnsStatusPollInterval, defaultDnsStatusPollInterval)
+	if err != nil {
+		return StatusWaitPolicy{}, err
+	}
+	policy.PollInterval = pollInterval
+	return policy, nil
+}
+
+// Loads a duration, that must be greater than 0, from the environment.
+func getPositiveDuration(env string, defaultDuration time.Duration) (time.Duration, error) {
+	if os.Getenv(env) == "" {
+		return defaultDuration, nil
+	}
+	duration, err := time.ParseDuration(os.Getenv(env))
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %s", env, err)
+	}
+	if duration <= 0 {
+		return 0, fmt.Errorf("invalid %s: must be greater than 0", env)
+	}
+	return duration, nil
+}
+
+// Loads the endpoint of the ECS metadata service from the environment.
+func getMetadataEndpoint() string {
+	if os.Getenv(envMetadataEndpoint) == "" {
+		return defaultMetadataEndpoint
+	}
+	return os.Getenv(envMetadataEndpoint)
+}
+
+// Loads the API group of the webhook from the environment.
+func getGroupName() string {
+	if os.Getenv(envGroupName) == "" {
+		return defaultGroupName
+	}
+	return os.Getenv(envGroupName)
+}
+
+// Loads the cluster resource namespace of cert-manager from the environment.
+func getClusterResourceNamespace() string {
+	if os.Getenv(envClusterResourceNamespace) == "" {
+		return defaultClusterResourceNamespace
+	}
+	return os.Getenv(envClusterResourceNamespace)
+}
+
+// Loads the name of the pod of the webhook from the environment. Falls back to the host name, that is the pod name in Kubernetes.
+func getPodName() string {
+	if os.Getenv(envPodName) != "" {
+		return os.Getenv(envPodName)
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		return ""
+	}
+	return hostname
+}
+
+// Loads the name of the cluster the webhook runs in from the environment.
+func getClusterName() string {
+	return os.Getenv(envClusterName)
+}
+
+// Loads the ID of the cluster the webhook runs in from the environment. Falls back to the name of the cluster.
+func getClusterID() string {
+	if os.Getenv(envClusterID) == "" {
+		return getClusterName()
+	}
+	return os.Getenv(envClusterID)
+}
+
+// Loads the path of the projected service account token from the environment.
+func getIdTokenFile() string {
+	if os.Getenv(envIdTokenFile) == "" {
+		return defaultIdTokenFile
+	}
+	return os.Getenv(envIdTokenFile)
+}
+
+// Loads the interval of the preflight checks from the environment.
+func getPreflightInterval() (time.Duration, error) {
+	if os.Getenv(envPreflightInterval) == "" {
+		return defaultPreflightInterval, nil
+	}
+	interval, err := time.ParseDuration(os.Getenv(envPreflightInterval))
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %s", envPreflightInterval, err)
+	}
+	return interval, nil
+}
+
 // ===========================================================================
 // Local configuration (Environment, cloud.yaml)
 // ===========================================================================
@@ -78,17 +541,45 @@ const (
 	// otcuser, otcaksk
 	OtcProfileNameUser string = "otcuser"
 	OtcProfileNameAkSk string = "otcaksk"
+
+	// The optional keys of the secret of a clouds.yaml with the secure.yaml and the clouds-public.yaml, that belong to it.
+	cloudsSecureYamlKey string = "secure.yaml"
+	cloudsPublicYamlKey string = "clouds-public.yaml"
+	// The placeholder of the region in the auth URL of a public cloud profile.
+	cloudsRegionPlaceholder string = "{region_name}"
 )
 
 // Creates a ProviderClient and authenticates it, with a configuration we load from Kubernetes.
 //
 // https://github.com/opentelekomcloud/gophertelekomcloud/blob/v0.3.2/auth_options.go
 func getProviderClientWithAccessKeyAuth(authOpts otc.AuthOptionsProvider) (*otc.ProviderClient, error) {
-	provider, err := otcos.AuthenticatedClient(authOpts)
+	provider, _, err := getProviderClientWithTokenExpiry(authOpts)
+	return provider, err
+}
+
+// Creates a ProviderClient and authenticates it like getProviderClientWithAccessKeyAuth.
+// Returns the time the token of the authentication expires, too. The time is zero, when there is no token, e.g. with AK/SK.
+func getProviderClientWithTokenExpiry(authOpts otc.AuthOptionsProvider) (*otc.ProviderClient, time.Time, error) {
+	provider, err := otcos.NewClient(authOpts.GetIdentityEndpoint())
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("provider creation has failed: %s", err)
+	}
+
+	// Temporary AK/SK credentials are only accepted together with their security token.
+	if akskAuthOpts, ok := authOpts.(otc.AKSKAuthOptions); ok && akskAuthOpts.SecurityToken != "" {
+		provider.HTTPClient.Transport = &securityTokenTransport{securityToken: akskAuthOpts.SecurityToken}
+	}
+
+	// The transport is only installed during the authentication.
+	transport := provider.HTTPClient.Transport
+	recorder := &authenticationResponseTransport{next: transport}
+	provider.HTTPClient.Transport = recorder
+	err = otcos.Authenticate(provider, authOpts)
+	provider.HTTPClient.Transport = transport
 	if err != nil {
-		return nil, fmt.Errorf("provider creation has failed: %s", err)
+		return nil, time.Time{}, fmt.Errorf("provider creation has failed: %w", recorder.wrapError(err))
 	}
-	return provider, nil
+	return provider, recorder.tokenExpiresAt, nil
 }
 
 var EnvOS = otcos.NewEnv(envPrefix)
@@ -136,6 +627,149 @@ func getCloudProfile(otcProfileName string) (*otcos.Cloud, error) {
 	return cloud, nil
 }
 
+// The loader keeps the last loaded cloud in the env. Concurrent challenges must not load at the same time.
+var ambientCloudMutex sync.Mutex
+
+// Loads the ambient configuration of the webhook into a 'Cloud' object.
+// The configuration is loaded from the OS_* environment variables and/or the clouds.yaml mounted into the webhook container.
+// The cloud is selected by OS_CLOUD. It can be omitted, when there is only one cloud.
+func getAmbientCloud() (*otcos.Cloud, error) {
+	ambientCloudMutex.Lock()
+	defer ambientCloudMutex.Unlock()
+
+	cloud, err := EnvOS.Cloud()
+	if err != nil {
+		return nil, fmt.Errorf("error constructing ambient cloud configuration: %s", err)
+	}
+
+	cloud, err = copyCloud(cloud)
+	if err != nil {
+		return nil, fmt.Errorf("error copying cloud: %s", err)
+	}
+
+	return cloud, nil
+}
+
+// Loads the cloud with the given profile name from the content of a clouds.yaml into a 'Cloud' object.
+// The cloud is merged like the loader of getCloudProfile merges it: The cloud of the same name in the secure.yaml
+// fills in the values, that the clouds.yaml omits, e.g. the secrets. The profile of the cloud in the clouds-public.yaml
+// fills in the remaining values. Without a clouds-public.yaml, the OTC profile of the SDK is used, e.g. for "profile: otc".
+// Unlike the loader, the OS_* environment variables and the files of the webhook container are not merged,
+// because they hold the ambient configuration of the webhook and not the one of the issuer.
+// The secure.yaml and the clouds-public.yaml are optional. The profile name can be omitted, when the clouds.yaml contains exactly one cloud.
+func getCloudFromCloudsYaml(cloudsYaml []byte, secureYaml []byte, publicYaml []byte, otcProfileName string) (*otcos.Cloud, error) {
+	cloudsConfig := new(otcos.Config)
+	if err := yaml.Unmarshal(cloudsYaml, cloudsConfig); err != nil {
+		return nil, fmt.Errorf("error decoding clouds.yaml: %s", err)
+	}
+
+	if otcProfileName == "" {
+		if len(cloudsConfig.Clouds) != 1 {
+			return nil, fmt.Errorf("clouds.yaml contains %d clouds. Select one with cloudsProfile", len(cloudsConfig.Clouds))
+		}
+		for name := range cloudsConfig.Clouds {
+			otcProfileName = name
+		}
+	}
+
+	cloud, ok := cloudsConfig.Clouds[otcProfileName]
+	if !ok {
+		return nil, fmt.Errorf("cloud %q not found in clouds.yaml", otcProfileName)
+	}
+
+	if len(secureYaml) > 0 {
+		secureConfig := new(otcos.Config)
+		if err := yaml.Unmarshal(secureYaml, secureConfig); err != nil {
+			return nil, fmt.Errorf("error decoding secure.yaml: %s", err)
+		}
+		if secureCloud, ok := secureConfig.Clouds[otcProfileName]; ok {
+			merged, err := mergeClouds(&cloud, &secureCloud)
+			if err != nil {
+				return nil, fmt.Errorf("error merging secure.yaml: %s", err)
+			}
+			cloud = *merged
+		}
+	}
+
+	publicConfig := otcos.OTCVendorConfig
+	if len(publicYaml) > 0 {
+		publicConfig = new(otcos.VendorConfig)
+		if err := yaml.Unmarshal(publicYaml, publicConfig); err != nil {
+			return nil, fmt.Errorf("error decoding clouds-public.yaml: %s", err)
+		}
+	}
+	profile := cloud.Profile
+	if profile == "" {
+		profile = cloud.Cloud
+	}
+	if publicCloud, ok := publicConfig.Clouds[profile]; ok && profile != "" {
+		merged, err := mergeClouds(&cloud, &publicCloud)
+		if err != nil {
+			return nil, fmt.Errorf("error merging profile %q of clouds-public.yaml: %s", profile, err)
+		}
+		cloud = *merged
+	}
+
+	cloud.Cloud = otcProfileName
+	computeCloudRegion(&cloud)
+
+	return copyCloud(&cloud)
+}
+
+// Merges the fallback into the cloud. The values of the cloud take precedence, also within the auth section.
+// See also gophertelekomcloud/openstack/loader.go
+func mergeClouds(cloud *otcos.Cloud, fallback *otcos.Cloud) (*otcos.Cloud, error) {
+	cloudInterface, err := cloudToInterface(cloud)
+	if err != nil {
+		return nil, err
+	}
+	fallbackInterface, err := cloudToInterface(fallback)
+	if err != nil {
+		return nil, err
+	}
+
+	mergedJson, err := json.Marshal(otcutils.MergeInterfaces(cloudInterface, fallbackInterface))
+	if err != nil {
+		return nil, fmt.Errorf("error marshalling merged cloud: %s", err)
+	}
+	merged := new(otcos.Cloud)
+	if err := json.Unmarshal(mergedJson, merged); err != nil {
+		return nil, fmt.Errorf("error unmarshalling merged cloud: %s", err)
+	}
+	return merged, nil
+}
+
+// Converts the cloud into the generic JSON structure, that is merged.
+func cloudToInterface(cloud *otcos.Cloud) (interface{}, error) {
+	cloudJson, err := json.Marshal(cloud)
+	if err != nil {
+		return nil, fmt.Errorf("error marshalling cloud: %s", err)
+	}
+	var res interface{}
+	if err := json.Unmarshal(cloudJson, &res); err != nil {
+		return nil, fmt.Errorf("error unmarshalling cloud: %s", err)
+	}
+	return res, nil
+}
+
+// Derives the region of the cloud from its project name, e.g. "eu-de" from "eu-de_project", when the cloud names none.
+// The region is filled into the auth URL of a public cloud profile.
+// See also gophertelekomcloud/openstack/loader.go
+func computeCloudRegion(cloud *otcos.Cloud) {
+	if cloud.RegionName != "" {
+		return
+	}
+	name := cloud.AuthInfo.ProjectName
+	if name == "" {
+		name = cloud.AuthInfo.DelegatedProject
+	}
+	cloud.RegionName = strings.Split(name, "_")[0]
+
+	if cloud.RegionName != "" {
+		cloud.AuthInfo.AuthURL = strings.ReplaceAll(cloud.AuthInfo.AuthURL, cloudsRegionPlaceholder, cloud.RegionName)
+	}
+}
+
 // Creates a deep copy of the given cloud data.
 // Returns the copy.
 // See also gophertelekomcloud/acceptance/clients/clients.go
@@ -0,0 +1,181 @@
+// The tests in this file test the decoding of the solver configuration.
+package otcdns
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	extapi "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+)
+
+// ===========================================================================
+// clouds.yaml
+// ===========================================================================
+
+// Tests, if a profile can be selected from the example clouds.yaml.
+func TestGetCloudFromCloudsYaml(t *testing.T) {
+	cloudsYaml, err := os.ReadFile("../_examples/clouds.yaml")
+	if err != nil {
+		t.Fatalf("Unable to read example clouds.yaml: %v", err)
+	}
+
+	cloud, err := getCloudFromCloudsYaml(cloudsYaml, nil, nil, OtcProfileNameAkSk)
+	if err != nil {
+		t.Fatalf("Unable to load cloud: %v", err)
+	}
+	assert.Equal(t, OtcProfileNameAkSk, cloud.Cloud, "The cloud name must be the selected profile.")
+	assert.Equal(t, "https://iam.eu-de.otc.t-systems.com:443/v3", cloud.AuthInfo.AuthURL)
+	assert.Equal(t, "<OTCDNS ACCESSKEY>", cloud.AuthInfo.AccessKey)
+
+	cloud, err = getCloudFromCloudsYaml(cloudsYaml, nil, nil, OtcProfileNameUser)
+	if err != nil {
+		t.Fatalf("Unable to load cloud: %v", err)
+	}
+	assert.Equal(t, "<USERNAME>", cloud.AuthInfo.Username)
+	assert.Equal(t, "<DOMAIN_NAME>", cloud.AuthInfo.DomainName)
+}
+
+// Tests, that a missing or ambiguous profile is reported.
+func TestGetCloudFromCloudsYamlProfileSelection(t *testing.T) {
+	cloudsYaml, err := os.ReadFile("../_examples/clouds.yaml")
+	if err != nil {
+		t.Fatalf("Unable to read example clouds.yaml: %v", err)
+	}
+
+	_, err = getCloudFromCloudsYaml(cloudsYaml, nil, nil, "unknown")
+	assert.Error(t, err, "An unknown profile must be reported.")
+
+	_, err = getCloudFromCloudsYaml(cloudsYaml, nil, nil, "")
+	assert.Error(t, err, "Without profile the clouds.yaml must contain exactly one cloud.")
+
+	singleCloudYaml := []byte("clouds:\n  single:\n    auth:\n      auth_url: 'https://iam.example.com/v3'\n")
+	cloud, err := getCloudFromCloudsYaml(singleCloudYaml, nil, nil, "")
+	if err != nil {
+		t.Fatalf("Unable to load single cloud: %v", err)
+	}
+	assert.Equal(t, "single", cloud.Cloud)
+}
+
+// Tests, if the secure.yaml and the profile of the clouds-public.yaml are merged into the cloud like the SDK loader merges them.
+func TestGetCloudFromCloudsYamlMerge(t *testing.T) {
+	cloudsYaml := []byte(`
+clouds:
+  team:
+    profile: otc
+    auth:
+      project_name: eu-nl_team
+      ak: clouds-ak
+`)
+	secureYaml := []byte(`
+clouds:
+  team:
+    auth:
+      ak: secure-ak
+      sk: secure-sk
+  other:
+    auth:
+      sk: other-sk
+`)
+
+	cloud, err := getCloudFromCloudsYaml(cloudsYaml, secureYaml, nil, "team")
+	if err != nil {
+		t.Fatalf("Unable to load cloud: %v", err)
+	}
+	assert.Equal(t, "team", cloud.Cloud)
+	assert.Equal(t, "clouds-ak", cloud.AuthInfo.AccessKey, "The clouds.yaml takes precedence over the secure.yaml.")
+	assert.Equal(t, "secure-sk", cloud.AuthInfo.SecretKey, "The secure.yaml fills in the missing secrets.")
+	assert.Equal(t, "eu-nl", cloud.RegionName, "The region is derived from the project name.")
+	assert.Equal(t, "https://iam.eu-nl.otc.t-systems.com/v3", cloud.AuthInfo.AuthURL, "The OTC profile of the SDK provides the auth URL of the region.")
+
+	publicYaml := []byte(`
+public-clouds:
+  otc:
+    auth:
+      auth_url: 'https://iam.{region_name}.example.com/v3'
+`)
+	cloud, err = getCloudFromCloudsYaml(cloudsYaml, nil, publicYaml, "team")
+	if err != nil {
+		t.Fatalf("Unable to load cloud: %v", err)
+	}
+	assert.Equal(t, "https://iam.eu-nl.example.com/v3", cloud.AuthInfo.AuthURL, "The clouds-public.yaml replaces the OTC profile of the SDK.")
+	assert.Equal(t, "", cloud.AuthInfo.SecretKey)
+
+	_, err = getCloudFromCloudsYaml(cloudsYaml, []byte("clouds: ["), nil, "team")
+	assert.Error(t, err, "An invalid secure.yaml must be reported.")
+}
+
+// Tests, if the solver merges the secure.yaml of the secret of the clouds.yaml into the selected cloud.
+func TestCloudsYamlSecretWithSecureYaml(t *testing.T) {
+	iam := newFakeIam(t, nil)
+	solver := newSolverWithSecrets(t, &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "otcdns-clouds"},
+		Data: map[string][]byte{
+			"clouds.yaml": []byte(fmt.Sprintf("clouds:\n  team:\n    auth:\n      auth_url: %q\n      username: user\n      domain_name: domain\n      project_name: eu-de\n", iam.authURL())),
+			"secure.yaml": []byte("clouds:\n  team:\n    auth:\n      password: secure-password\n"),
+		},
+	})
+	config := &OtcDnsConfig{Region: "eu-de", CloudsYamlSecretRef: newSecretKeySelector("otcdns-clouds", "clouds.yaml")}
+
+	_, err := solver.getOtcDnsClientFromConfig(config, "team-a", false)
+	if err != nil {
+		t.Fatalf("Unable to create client: %v", err)
+	}
+	tokenRequests := iam.getTokenRequests()
+	if assert.Len(t, tokenRequests, 1) {
+		identity, _ := json.Marshal(tokenRequests[0].Auth["identity"])
+		assert.Contains(t, string(identity), `"password":"secure-password"`, "The password of the secure.yaml must be used.")
+	}
+}
+
+// ===========================================================================
+// Solver configuration
+// ===========================================================================
+
+// Tests, if the secret references are decoded with and without namespace.
+func TestConfigJsonToOtcDnsConfigSecretNamespace(t *testing.T) {
+	cfgJSON := &extapi.JSON{Raw: []byte(`{
+		"accessKeySecretRef": {"name": "otcdns-credentials", "key": "accessKey", "namespace": "otc-credentials"},
+		"secretKeySecretRef": {"name": "otcdns-credentials", "key": "secretKey"}
+	}`)}
+
+	cfg, err := configJsonToOtcDnsConfig(cfgJSON)
+	if err != nil {
+		t.Fatalf("Unable to decode config: %v", err)
+	}
+	assert.Equal(t, "otcdns-credentials", cfg.AccessKeySecretRef.Name)
+	assert.Equal(t, "accessKey", cfg.AccessKeySecretRef.Key)
+	assert.Equal(t, "otc-credentials", cfg.AccessKeySecretRef.Namespace)
+	assert.Equal(t, "secretKey", cfg.SecretKeySecretRef.Key)
+	assert.Equal(t, "", cfg.SecretKeySecretRef.Namespace, "The namespace is optional.")
+}
+
+// ===========================================================================
+// Webhook configuration
+// ===========================================================================
+
+// Tests, that the webhook does not start, when a variable of its environment is invalid.
+func TestInitializeFailsOnInvalidEnvironment(t *testing.T) {
+	t.Setenv(envDnsReadTimeout, "thirty seconds")
+	t.Setenv(envDnsRateLimitBurst, "0")
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+
+	err := NewSolver().Initialize(&rest.Config{Host: "http://127.0.0.1:1"}, stopCh)
+	assert.ErrorContains(t, err, envDnsReadTimeout)
+	assert.ErrorContains(t, err, envDnsRateLimitBurst, "All invalid variables must be reported at once.")
+}
+
+// Tests, that the defaults are used, when the environment configures nothing.
+func TestNewSolverWithDefaultEnvironment(t *testing.T) {
+	solver := NewSolver().(*OtcDnsSolver)
+	assert.NoError(t, solver.configErr)
+	assert.Equal(t, getDefaultDnsRetryPolicy(), solver.retryPolicy)
+	assert.Equal(t, defaultDnsOperationTimeout, solver.timeouts.Read)
+	assert.Equal(t, defaultPreflightInterval, solver.preflightInterval)
+}
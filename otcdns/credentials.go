@@ -0,0 +1,286 @@
+package otcdns
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/klog"
+)
+
+// ===========================================================================
+// Credential providers
+// ===========================================================================
+
+// The built-in credential providers, that can be selected with OtcDnsConfig.CredentialProvider.
+const (
+	CredentialProviderKubernetes string = "kubernetes"
+	CredentialProviderFile       string = "file"
+	CredentialProviderEnv        string = "env"
+	CredentialProviderExec       string = "exec"
+	CredentialProviderCSMS       string = "csms"
+	CredentialProviderMetadata   string = "metadata"
+)
+
+// Credentials are the secrets the webhook authenticates with at the OTC IAM.
+// Which of them are used depends on the authType of the solver configuration.
+// A token replaces all other credentials.
+// The JSON form is read by the file and the exec provider.
+type Credentials struct {
+	AccessKey     string `json:"accessKey,omitempty"`
+	SecretKey     string `json:"secretKey,omitempty"`
+	SecurityToken string `json:"securityToken,omitempty"`
+
+	Username   string `json:"username,omitempty"`
+	Password   string `json:"password,omitempty"`
+	DomainName string `json:"domainName,omitempty"`
+	ProjectID  string `json:"projectID,omitempty"`
+
+	// A pre-issued, scoped IAM token.
+	Token string `json:"token,omitempty"`
+
+	// Optional time the credentials expire. Providers may cache the credentials until then.
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+// CredentialRequest describes for which solver configuration the credentials are loaded.
+type CredentialRequest struct {
+	Config *OtcDnsConfig
+	// The resource namespace of the challenge. The namespace of the Issuer or the cluster resource namespace for a ClusterIssuer.
+	Namespace string
+	// Tells, if cert-manager allows the issuer to use the credentials of the webhook itself.
+	AllowAmbientCredentials bool
+}
+
+// CredentialProvider loads the credentials for a solver configuration.
+// The provider is selected with the credentialProvider field of the solver configuration.
+// Additional providers can be registered with NewSolverWithCredentialProviders.
+type CredentialProvider interface {
+	// The name the provider is selected with.
+	Name() string
+	// Loads the credentials for the given request.
+	GetCredentials(request *CredentialRequest) (*Credentials, error)
+}
+
+// Registers the given credential providers. A provider replaces a provider with the same name.
+func (s *OtcDnsSolver) registerCredentialProviders(providers ...CredentialProvider) {
+	if s.credentialProviders == nil {
+		s.credentialProviders = map[string]CredentialProvider{}
+	}
+	for _, provider := range providers {
+		s.credentialProviders[provider.Name()] = provider
+	}
+}
+
+// Returns the credential provider selected in the configuration.
+// Without a selection the files or the CSMS secret are used, when they are referenced. The Kubernetes secrets otherwise.
+func (s *OtcDnsSolver) getCredentialProvider(config *OtcDnsConfig) (CredentialProvider, error) {
+	name := config.CredentialProvider
+	switch {
+	case name != "":
+	case config.hasCredentialFiles():
+		name = CredentialProviderFile
+	case config.CsmsSecretName != "":
+		name = CredentialProviderCSMS
+	default:
+		name = CredentialProviderKubernetes
+	}
+	provider, ok := s.credentialProviders[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown credentialProvider %q", name)
+	}
+	return provider, nil
+}
+
+// ---------------------------------------------------------------------------
+// Kubernetes secrets
+// ---------------------------------------------------------------------------
+
+// Loads the credentials from the Kubernetes secrets referenced in the solver configuration.
+// The inline accessKey and secretKey of the configuration are supported for local tests.
+type kubernetesSecretCredentialProvider struct {
+	solver *OtcDnsSolver
+}
+
+func (p *kubernetesSecretCredentialProvider) Name() string {
+	return CredentialProviderKubernetes
+}
+
+func (p *kubernetesSecretCredentialProvider) GetCredentials(request *CredentialRequest) (*Credentials, error) {
+	return p.solver.getOtcDnsSecrets(request.Config, request.Namespace)
+}
+
+// ---------------------------------------------------------------------------
+// Files
+// ---------------------------------------------------------------------------
+
+// Loads the credentials from files in the webhook container, e.g. secrets mounted by a secrets-store CSI driver.
+// Either the JSON file referenced with credentialsFile is read, or the files referenced with accessKeyFile,
+// secretKeyFile, securityTokenFile and tokenFile.
+// The files must be located in one of the directories allowed with CREDENTIAL_FILE_DIRS.
+// A file is read again, when it changes on disk.
+// The files are mounted into the webhook. They are only provided, when cert-manager allows ambient credentials for the issuer.
+type fileCredentialProvider struct {
+	allowedDirs []string
+
+	mutex sync.Mutex
+	files map[string]*credentialFile
+}
+
+// The content of a credentials file and the state of the file it was read at.
+type credentialFile struct {
+	// The file the symbolic links resolved to. CSI drivers point the links to a new file on rotation.
+	resolvedPath string
+	modTime      time.Time
+	size         int64
+	content      []byte
+}
+
+func newFileCredentialProvider(allowedDirs []string) *fileCredentialProvider {
+	return &fileCredentialProvider{
+		allowedDirs: allowedDirs,
+		files:       map[string]*credentialFile{},
+	}
+}
+
+func (p *fileCredentialProvider) Name() string {
+	return CredentialProviderFile
+}
+
+func (p *fileCredentialProvider) GetCredentials(request *CredentialRequest) (*Credentials, error) {
+	if !request.AllowAmbientCredentials {
+		return nil, fmt.Errorf("credentialProvider %q reads the files of the webhook, but ambient credentials are not allowed for this issuer", CredentialProviderFile)
+	}
+
+	config := request.Config
+	if config.CredentialsFile != "" {
+		content, err := p.readFile(config.CredentialsFile)
+		if err != nil {
+			return nil, err
+		}
+		credentials := &Credentials{}
+		if err := json.Unmarshal(content, credentials); err != nil {
+			return nil, fmt.Errorf("cannot decode credentials file %s. %s", config.CredentialsFile, err)
+		}
+		return credentials, nil
+	}
+
+	if !config.hasCredentialFiles() {
+		return nil, fmt.Errorf("credentialProvider %q requires credentialsFile or accessKeyFile and secretKeyFile", CredentialProviderFile)
+	}
+
+	credentials := &Credentials{}
+	for _, file := range []struct {
+		path  string
+		value *string
+	}{
+		{config.AccessKeyFile, &credentials.AccessKey},
+		{config.SecretKeyFile, &credentials.SecretKey},
+		{config.SecurityTokenFile, &credentials.SecurityToken},
+		{config.TokenFile, &credentials.Token},
+	} {
+		if file.path == "" {
+			continue
+		}
+		content, err := p.readFile(file.path)
+		if err != nil {
+			return nil, err
+		}
+		*file.value = strings.TrimSpace(string(content))
+	}
+	return credentials, nil
+}
+
+// Returns the content of the given file. The file is only read again, when it changed since the last read.
+func (p *fileCredentialProvider) readFile(path string) ([]byte, error) {
+	resolvedPath, err := p.resolvePath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	fileInfo, err := os.Stat(resolvedPath)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read credentials file. %s", err)
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if file, ok := p.files[path]; ok && file.resolvedPath == resolvedPath && file.modTime.Equal(fileInfo.ModTime()) && file.size == fileInfo.Size() {
+		return file.content, nil
+	}
+
+	content, err := os.ReadFile(resolvedPath)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read credentials file. %s", err)
+	}
+	if _, ok := p.files[path]; ok {
+		klog.Infof("credentials file %s changed. Using the new content", path)
+	}
+	p.files[path] = &credentialFile{
+		resolvedPath: resolvedPath,
+		modTime:      fileInfo.ModTime(),
+		size:         fileInfo.Size(),
+		content:      content,
+	}
+	return content, nil
+}
+
+// Resolves the symbolic links of the given path and checks, that the file is located in an allowed directory.
+// The content of the file is sent to the auth URL of the solver configuration. Other files of the webhook must not be readable.
+// CSI drivers replace the symbolic links on rotation. The path is resolved for every read.
+func (p *fileCredentialProvider) resolvePath(path string) (string, error) {
+	if !filepath.IsAbs(path) {
+		return "", fmt.Errorf("credentials file %s must be an absolute path", path)
+	}
+	resolvedPath, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", fmt.Errorf("cannot resolve credentials file. %s", err)
+	}
+
+	for _, allowedDir := range p.allowedDirs {
+		resolvedDir, err := filepath.EvalSymlinks(allowedDir)
+		if err != nil {
+			continue
+		}
+		relPath, err := filepath.Rel(resolvedDir, resolvedPath)
+		if err == nil && relPath != ".." && !strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+			return resolvedPath, nil
+		}
+	}
+	return "", fmt.Errorf("credentials file %s is not located in a directory allowed with %s", path, envCredentialFileDirs)
+}
+
+// ---------------------------------------------------------------------------
+// Environment
+// ---------------------------------------------------------------------------
+
+// Loads the credentials from the OS_* environment variables of the webhook.
+// Unlike the ambient credentials, the auth URL, the region and the scope are taken from the solver configuration.
+// These are credentials of the webhook itself. They are only provided, when cert-manager allows ambient credentials for the issuer.
+type envCredentialProvider struct{}
+
+func (p *envCredentialProvider) Name() string {
+	return CredentialProviderEnv
+}
+
+func (p *envCredentialProvider) GetCredentials(request *CredentialRequest) (*Credentials, error) {
+	if !request.AllowAmbientCredentials {
+		return nil, fmt.Errorf("credentialProvider %q uses the environment of the webhook, but ambient credentials are not allowed for this issuer", CredentialProviderEnv)
+	}
+
+	return &Credentials{
+		AccessKey:     os.Getenv(envPrefix + "ACCESS_KEY"),
+		SecretKey:     os.Getenv(envPrefix + "SECRET_KEY"),
+		SecurityToken: os.Getenv(envPrefix + "SECURITY_TOKEN"),
+		Username:      os.Getenv(envPrefix + "USERNAME"),
+		Password:      os.Getenv(envPrefix + "PASSWORD"),
+		DomainName:    os.Getenv(envPrefix + "DOMAIN_NAME"),
+		ProjectID:     os.Getenv(envPrefix + "PROJECT_ID"),
+		Token:         os.Getenv(envPrefix + "TOKEN"),
+	}, nil
+}
@@ -0,0 +1,225 @@
+// The tests in this file test the credential providers.
+package otcdns
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Tests, if the credentials are read from the output of the exec plugin and cached until they expire.
+func TestExecCredentialProvider(t *testing.T) {
+	counterFile := filepath.Join(t.TempDir(), "calls")
+	expiresAt := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	script := `echo call >> "` + counterFile + `"
+echo "$OTCDNS_EXEC_INFO" | grep -q '"namespace":"team-a"' || exit 1
+echo '{"accessKey": "broker-ak", "secretKey": "broker-sk", "expiresAt": "` + expiresAt + `"}'`
+
+	provider := newExecCredentialProvider([]string{"/bin/sh", "-c", script})
+	request := &CredentialRequest{Config: &OtcDnsConfig{CredentialProvider: CredentialProviderExec}, Namespace: "team-a", AllowAmbientCredentials: true}
+
+	credentials, err := provider.GetCredentials(request)
+	if err != nil {
+		t.Fatalf("Unable to get credentials: %v", err)
+	}
+	assert.Equal(t, "broker-ak", credentials.AccessKey)
+	assert.Equal(t, "broker-sk", credentials.SecretKey)
+
+	_, err = provider.GetCredentials(request)
+	assert.NoError(t, err)
+	calls, _ := os.ReadFile(counterFile)
+	assert.Equal(t, "call\n", string(calls), "Credentials that did not expire must be served from the cache.")
+}
+
+// Tests, that a slow exec plugin does not block the requests of other issuers,
+// and that concurrent requests of the same issuer run the plugin once.
+func TestExecCredentialProviderConcurrency(t *testing.T) {
+	dir := t.TempDir()
+	counterFile := filepath.Join(dir, "calls")
+	startedFile := filepath.Join(dir, "started")
+	releaseFile := filepath.Join(dir, "release")
+	expiresAt := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	script := `if echo "$OTCDNS_EXEC_INFO" | grep -q '"namespace":"slow"'; then
+  touch "` + startedFile + `"
+  while [ ! -f "` + releaseFile + `" ]; do sleep 0.01; done
+  echo slow >> "` + counterFile + `"
+else
+  echo fast >> "` + counterFile + `"
+fi
+echo '{"accessKey": "broker-ak", "secretKey": "broker-sk", "expiresAt": "` + expiresAt + `"}'`
+	provider := newExecCredentialProvider([]string{"/bin/sh", "-c", script})
+	newRequest := func(namespace string) *CredentialRequest {
+		return &CredentialRequest{Config: &OtcDnsConfig{CredentialProvider: CredentialProviderExec}, Namespace: namespace, AllowAmbientCredentials: true}
+	}
+
+	errs := make(chan error, 4)
+	for i := 0; i < cap(errs); i++ {
+		go func() {
+			_, err := provider.GetCredentials(newRequest("slow"))
+			errs <- err
+		}()
+	}
+
+	assert.Eventually(t, func() bool {
+		_, err := os.Stat(startedFile)
+		return err == nil
+	}, 10*time.Second, 10*time.Millisecond, "The plugin of the slow issuer must start.")
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := provider.GetCredentials(newRequest("team-a"))
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(10 * time.Second):
+		t.Error("The plugin must run for another issuer, while the plugin of the slow issuer runs.")
+	}
+
+	if err := os.WriteFile(releaseFile, nil, 0600); err != nil {
+		t.Fatalf("Unable to release the plugin: %v", err)
+	}
+	for i := 0; i < cap(errs); i++ {
+		assert.NoError(t, <-errs)
+	}
+	calls, _ := os.ReadFile(counterFile)
+	assert.Equal(t, 1, strings.Count(string(calls), "slow"), "Concurrent requests of the same issuer must run the plugin once.")
+}
+
+// Tests, that a failing exec plugin is reported with its error output.
+func TestExecCredentialProviderFailure(t *testing.T) {
+	provider := newExecCredentialProvider([]string{"/bin/sh", "-c", "echo 'broker unavailable' >&2; exit 1"})
+	_, err := provider.GetCredentials(&CredentialRequest{Config: &OtcDnsConfig{}, AllowAmbientCredentials: true})
+	assert.ErrorContains(t, err, "broker unavailable")
+
+	_, err = newExecCredentialProvider(nil).GetCredentials(&CredentialRequest{Config: &OtcDnsConfig{}})
+	assert.ErrorContains(t, err, envCredentialExecCommand, "The exec provider must not run without a command configured for the webhook.")
+}
+
+// Tests, if the file provider reads the credentials file only from the allowed directories.
+func TestFileCredentialProvider(t *testing.T) {
+	allowedDir := t.TempDir()
+	credentialsFile := filepath.Join(allowedDir, "credentials.json")
+	if err := os.WriteFile(credentialsFile, []byte(`{"accessKey": "file-ak", "secretKey": "file-sk"}`), 0600); err != nil {
+		t.Fatalf("Unable to write credentials file: %v", err)
+	}
+	otherFile := filepath.Join(t.TempDir(), "credentials.json")
+	if err := os.WriteFile(otherFile, []byte(`{}`), 0600); err != nil {
+		t.Fatalf("Unable to write credentials file: %v", err)
+	}
+
+	provider := newFileCredentialProvider([]string{allowedDir})
+
+	credentials, err := provider.GetCredentials(&CredentialRequest{Config: &OtcDnsConfig{CredentialsFile: credentialsFile}, AllowAmbientCredentials: true})
+	if err != nil {
+		t.Fatalf("Unable to get credentials: %v", err)
+	}
+	assert.Equal(t, "file-ak", credentials.AccessKey)
+
+	_, err = provider.GetCredentials(&CredentialRequest{Config: &OtcDnsConfig{CredentialsFile: otherFile}, AllowAmbientCredentials: true})
+	assert.ErrorContains(t, err, envCredentialFileDirs, "Files outside the allowed directories must not be read.")
+
+	_, err = provider.GetCredentials(&CredentialRequest{Config: &OtcDnsConfig{CredentialsFile: filepath.Join(allowedDir, "..", filepath.Base(filepath.Dir(otherFile)), "credentials.json")}, AllowAmbientCredentials: true})
+	assert.Error(t, err, "Paths must not escape the allowed directories.")
+}
+
+// Tests, that the files and the command of the webhook are refused for namespaced Issuers.
+// cert-manager does not allow ambient credentials for them by default.
+func TestFileAndExecCredentialProviderRefuseNamespacedIssuers(t *testing.T) {
+	allowedDir := t.TempDir()
+	credentialsFile := filepath.Join(allowedDir, "credentials.json")
+	if err := os.WriteFile(credentialsFile, []byte(`{"accessKey": "platform-ak", "secretKey": "platform-sk"}`), 0600); err != nil {
+		t.Fatalf("Unable to write credentials file: %v", err)
+	}
+	counterFile := filepath.Join(t.TempDir(), "calls")
+
+	for _, provider := range []CredentialProvider{
+		newFileCredentialProvider([]string{allowedDir}),
+		newExecCredentialProvider([]string{"/bin/sh", "-c", `echo call >> "` + counterFile + `"; echo '{"accessKey": "platform-ak"}'`}),
+	} {
+		_, err := provider.GetCredentials(&CredentialRequest{
+			Config:                  &OtcDnsConfig{CredentialsFile: credentialsFile},
+			Namespace:               "team-a",
+			AllowAmbientCredentials: false,
+		})
+		assert.ErrorContains(t, err, "ambient credentials are not allowed", provider.Name())
+	}
+	_, err := os.Stat(counterFile)
+	assert.True(t, os.IsNotExist(err), "The exec plugin must not run for a namespaced Issuer.")
+}
+
+// Tests, that the environment of the webhook is only used, when ambient credentials are allowed.
+func TestEnvCredentialProvider(t *testing.T) {
+	t.Setenv("OS_ACCESS_KEY", "env-ak")
+	t.Setenv("OS_SECRET_KEY", "env-sk")
+	provider := &envCredentialProvider{}
+
+	_, err := provider.GetCredentials(&CredentialRequest{Config: &OtcDnsConfig{}, AllowAmbientCredentials: false})
+	assert.Error(t, err, "The environment must not be used without permission for ambient credentials.")
+
+	credentials, err := provider.GetCredentials(&CredentialRequest{Config: &OtcDnsConfig{}, AllowAmbientCredentials: true})
+	if err != nil {
+		t.Fatalf("Unable to get credentials: %v", err)
+	}
+	assert.Equal(t, "env-ak", credentials.AccessKey)
+	assert.Equal(t, "env-sk", credentials.SecretKey)
+}
+
+// Tests, if a custom provider can be registered and selected.
+func TestNewSolverWithCredentialProviders(t *testing.T) {
+	solver := NewSolverWithCredentialProviders(&envCredentialProvider{}).(*OtcDnsSolver)
+
+	provider, err := solver.getCredentialProvider(&OtcDnsConfig{})
+	assert.NoError(t, err)
+	assert.Equal(t, CredentialProviderKubernetes, provider.Name(), "The Kubernetes secrets are the default.")
+
+	provider, err = solver.getCredentialProvider(&OtcDnsConfig{AccessKeyFile: "/mnt/otc/accessKey"})
+	assert.NoError(t, err)
+	assert.Equal(t, CredentialProviderFile, provider.Name(), "Referenced files select the file provider.")
+
+	_, err = solver.getCredentialProvider(&OtcDnsConfig{CredentialProvider: "unknown"})
+	assert.Error(t, err)
+}
+
+// Tests, if the key files are read again, when they change on disk.
+func TestFileCredentialProviderRotation(t *testing.T) {
+	allowedDir := t.TempDir()
+	accessKeyFile := filepath.Join(allowedDir, "accessKey")
+	secretKeyFile := filepath.Join(allowedDir, "secretKey")
+	writeFile := func(path string, content string, modTime time.Time) {
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatalf("Unable to write file: %v", err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatalf("Unable to set modification time: %v", err)
+		}
+	}
+	now := time.Now()
+	writeFile(accessKeyFile, "old-ak\n", now.Add(-time.Hour))
+	writeFile(secretKeyFile, "old-sk\n", now.Add(-time.Hour))
+
+	provider := newFileCredentialProvider([]string{allowedDir})
+	request := &CredentialRequest{Config: &OtcDnsConfig{AccessKeyFile: accessKeyFile, SecretKeyFile: secretKeyFile}, AllowAmbientCredentials: true}
+
+	credentials, err := provider.GetCredentials(request)
+	if err != nil {
+		t.Fatalf("Unable to get credentials: %v", err)
+	}
+	assert.Equal(t, "old-ak", credentials.AccessKey, "The content must be trimmed.")
+	assert.Equal(t, "old-sk", credentials.SecretKey)
+
+	writeFile(accessKeyFile, "new-ak", now)
+	writeFile(secretKeyFile, "new-sk", now)
+
+	credentials, err = provider.GetCredentials(request)
+	if err != nil {
+		t.Fatalf("Unable to get credentials: %v", err)
+	}
+	assert.Equal(t, "new-ak", credentials.AccessKey, "A changed file must be read again.")
+	assert.Equal(t, "new-sk", credentials.SecretKey)
+}
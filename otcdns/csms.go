@@ -0,0 +1,174 @@
+package otcdns
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	otc "github.com/opentelekomcloud/gophertelekomcloud"
+	otcos "github.com/opentelekomcloud/gophertelekomcloud/openstack"
+	"golang.org/x/sync/singleflight"
+)
+
+// ===========================================================================
+// Cloud Secret Management Service (CSMS)
+// ===========================================================================
+
+const (
+	// The version of a CSMS secret that is fetched, when the solver configuration names no version.
+	csmsLatestVersion string = "latest"
+)
+
+// Loads the credentials from a secret of the OTC Cloud Secret Management Service.
+// The value of the secret version must be a JSON object with the credentials, e.g. {"accessKey": "...", "secretKey": "..."}.
+// The webhook reads the secret with its bootstrap identity. This is the ambient cloud configuration of the webhook
+// (OS_* environment variables and/or clouds.yaml). Therefore only issuers that may use ambient credentials can use this provider.
+// The fetched credentials are cached for CSMS_CACHE_TTL.
+type csmsCredentialProvider struct {
+	// The CSMS endpoint with a %s for the region, e.g. https://kms.%s.otc.t-systems.com
+	endpoint string
+	ttl      time.Duration
+	// Creates the client the secrets are read with.
+	// The project of the bootstrap identity is used, when the solver configuration names no project.
+	bootstrap func(endpoint string) (*otc.ServiceClient, error)
+
+	mutex sync.Mutex
+	cache map[string]*csmsCacheEntry
+	// Concurrent requests of the same cache key wait for the running fetch. The cache is not locked while it runs.
+	fetching singleflight.Group
+}
+
+type csmsCacheEntry struct {
+	credentials *Credentials
+	fetchedAt   time.Time
+}
+
+// The response of GET /v1/{project_id}/secrets/{secret_name}/versions/{version_id}.
+type csmsSecretVersionResponse struct {
+	Version struct {
+		SecretString string `json:"secret_string"`
+	} `json:"version"`
+}
+
+func newCsmsCredentialProvider(endpoint string, ttl time.Duration) *csmsCredentialProvider {
+	return &csmsCredentialProvider{
+		endpoint:  endpoint,
+		ttl:       ttl,
+		bootstrap: getCsmsBootstrapClient,
+		cache:     map[string]*csmsCacheEntry{},
+	}
+}
+
+func (p *csmsCredentialProvider) Name() string {
+	return CredentialProviderCSMS
+}
+
+func (p *csmsCredentialProvider) GetCredentials(request *CredentialRequest) (*Credentials, error) {
+	config := request.Config
+	if config.CsmsSecretName == "" {
+		return nil, fmt.Errorf("credentialProvider %q requires csmsSecretName", CredentialProviderCSMS)
+	}
+	// The secret is read with the identity of the webhook. It is an ambient credential like the OS_* variables.
+	if !request.AllowAmbientCredentials {
+		return nil, fmt.Errorf("credentialProvider %q uses the bootstrap identity of the webhook, but ambient credentials are not allowed for this issuer", CredentialProviderCSMS)
+	}
+
+	version := config.CsmsSecretVersion
+	if version == "" {
+		version = csmsLatestVersion
+	}
+	endpoint := p.getEndpoint(config.Region)
+	cacheKey := strings.Join([]string{endpoint, config.ProjectID, config.CsmsSecretName, version}, "/")
+
+	if credentials := p.getCached(cacheKey); credentials != nil {
+		return credentials, nil
+	}
+
+	result, err, _ := p.fetching.Do(cacheKey, func() (interface{}, error) {
+		serviceClient, err := p.bootstrap(endpoint)
+		if err != nil {
+			return nil, fmt.Errorf("cannot authenticate the bootstrap identity. %s", err)
+		}
+		projectID := config.ProjectID
+		if projectID == "" {
+			projectID = serviceClient.ProviderClient.ProjectID
+		}
+
+		credentials, err := fetchCsmsSecretVersion(serviceClient, projectID, config.CsmsSecretName, version)
+		if err != nil {
+			return nil, err
+		}
+		p.mutex.Lock()
+		p.cache[cacheKey] = &csmsCacheEntry{credentials: credentials, fetchedAt: time.Now()}
+		p.mutex.Unlock()
+		return credentials, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.(*Credentials), nil
+}
+
+// Returns the cached credentials of the given key. Returns nil, when there are none or when they are older than the TTL.
+func (p *csmsCredentialProvider) getCached(cacheKey string) *Credentials {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if entry, ok := p.cache[cacheKey]; ok && time.Since(entry.fetchedAt) < p.ttl {
+		return entry.credentials
+	}
+	return nil
+}
+
+// Builds the CSMS endpoint of the given region.
+func (p *csmsCredentialProvider) getEndpoint(region string) string {
+	if strings.Contains(p.endpoint, "%s") {
+		return fmt.Sprintf(p.endpoint, region)
+	}
+	return p.endpoint
+}
+
+// Reads the given version of a CSMS secret and decodes the credentials from its value.
+// https://docs.otc.t-systems.com/data-encryption-workshop/api-ref/csms_apis/secret_version_management/querying_the_secret_version_and_value.html
+func fetchCsmsSecretVersion(serviceClient *otc.ServiceClient, projectID string, secretName string, version string) (*Credentials, error) {
+	if projectID == "" {
+		return nil, fmt.Errorf("cannot read CSMS secret %s. The project is unknown. Set projectID or scope the bootstrap identity to a project", secretName)
+	}
+
+	var response csmsSecretVersionResponse
+	_, err := serviceClient.Get(serviceClient.ServiceURL("v1", projectID, "secrets", secretName, "versions", version), &response, nil)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read version %s of CSMS secret %s. %s", version, secretName, err)
+	}
+
+	credentials := &Credentials{}
+	if err := json.Unmarshal([]byte(response.Version.SecretString), credentials); err != nil {
+		return nil, fmt.Errorf("cannot decode version %s of CSMS secret %s. The value must be a JSON object with the credentials. %s", version, secretName, err)
+	}
+	return credentials, nil
+}
+
+// Authenticates the bootstrap identity of the webhook and creates a client for the given CSMS endpoint.
+func getCsmsBootstrapClient(endpoint string) (*otc.ServiceClient, error) {
+	cloud, err := getAmbientCloud()
+	if err != nil {
+		return nil, err
+	}
+
+	authOpts, err := otcos.AuthOptionsFromInfo(&cloud.AuthInfo, cloud.AuthType)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create auth options from cloud %s. %s", cloud.Cloud, err)
+	}
+
+	providerClient, err := getProviderClientWithAccessKeyAuth(authOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &otc.ServiceClient{
+		ProviderClient: providerClient,
+		Endpoint:       strings.TrimSuffix(endpoint, "/") + "/",
+	}, nil
+}
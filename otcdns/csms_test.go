@@ -0,0 +1,138 @@
+// The tests in this file test the credential provider for the Cloud Secret Management Service against a stand-in server.
+package otcdns
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	otc "github.com/opentelekomcloud/gophertelekomcloud"
+	"github.com/stretchr/testify/assert"
+)
+
+// A stand-in CSMS, that serves the secret "otcdns-credentials" of the project "project-id".
+func newFakeCSMS(t *testing.T, calls *int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*calls++
+		assert.Equal(t, "bootstrap-token", r.Header.Get("X-Auth-Token"), "The secret must be read with the bootstrap identity.")
+		if r.URL.Path != "/v1/project-id/secrets/otcdns-credentials/versions/latest" {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"error_code": "KMS.0207", "error_msg": "The secret does not exist."}`))
+			return
+		}
+		secretString, _ := json.Marshal(map[string]string{"accessKey": "csms-ak", "secretKey": "csms-sk"})
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"version": map[string]interface{}{"secret_string": string(secretString)},
+		})
+	}))
+}
+
+// Creates the provider with a bootstrap identity, that is authenticated with a fixed token.
+func newTestCsmsCredentialProvider(endpoint string) *csmsCredentialProvider {
+	provider := newCsmsCredentialProvider(endpoint, time.Hour)
+	provider.bootstrap = func(endpoint string) (*otc.ServiceClient, error) {
+		return &otc.ServiceClient{
+			ProviderClient: &otc.ProviderClient{TokenID: "bootstrap-token", ProjectID: "project-id"},
+			Endpoint:       endpoint + "/",
+		}, nil
+	}
+	return provider
+}
+
+// Tests, if the credentials are read from the latest version of the secret and cached.
+func TestCsmsCredentialProvider(t *testing.T) {
+	calls := 0
+	csms := newFakeCSMS(t, &calls)
+	defer csms.Close()
+
+	provider := newTestCsmsCredentialProvider(csms.URL)
+	request := &CredentialRequest{Config: &OtcDnsConfig{CsmsSecretName: "otcdns-credentials"}, AllowAmbientCredentials: true}
+
+	credentials, err := provider.GetCredentials(request)
+	if err != nil {
+		t.Fatalf("Unable to get credentials: %v", err)
+	}
+	assert.Equal(t, "csms-ak", credentials.AccessKey)
+	assert.Equal(t, "csms-sk", credentials.SecretKey)
+
+	_, err = provider.GetCredentials(request)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, calls, "The credentials must be served from the cache within the TTL.")
+}
+
+// Tests, that a slow read of a secret does not block the reads of other secrets,
+// and that concurrent requests of the same secret read it once.
+func TestCsmsCredentialProviderConcurrency(t *testing.T) {
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	var mutex sync.Mutex
+	slowCalls := 0
+	csms := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "/secrets/slow/") {
+			mutex.Lock()
+			slowCalls++
+			mutex.Unlock()
+			select {
+			case started <- struct{}{}:
+			default:
+			}
+			<-release
+		}
+		secretString, _ := json.Marshal(map[string]string{"accessKey": "csms-ak", "secretKey": "csms-sk"})
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"version": map[string]interface{}{"secret_string": string(secretString)},
+		})
+	}))
+	defer csms.Close()
+	provider := newTestCsmsCredentialProvider(csms.URL)
+	newRequest := func(secretName string) *CredentialRequest {
+		return &CredentialRequest{Config: &OtcDnsConfig{CsmsSecretName: secretName}, AllowAmbientCredentials: true}
+	}
+
+	errs := make(chan error, 4)
+	for i := 0; i < cap(errs); i++ {
+		go func() {
+			_, err := provider.GetCredentials(newRequest("slow"))
+			errs <- err
+		}()
+	}
+	<-started
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := provider.GetCredentials(newRequest("otcdns-credentials"))
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(10 * time.Second):
+		t.Error("Another secret must be read, while the slow secret is read.")
+	}
+
+	close(release)
+	for i := 0; i < cap(errs); i++ {
+		assert.NoError(t, <-errs)
+	}
+	assert.Equal(t, 1, slowCalls, "Concurrent requests of the same secret must read it once.")
+}
+
+// Tests, that a missing secret and a missing permission for ambient credentials are reported.
+func TestCsmsCredentialProviderErrors(t *testing.T) {
+	calls := 0
+	csms := newFakeCSMS(t, &calls)
+	defer csms.Close()
+
+	provider := newTestCsmsCredentialProvider(csms.URL)
+
+	_, err := provider.GetCredentials(&CredentialRequest{Config: &OtcDnsConfig{CsmsSecretName: "unknown"}, AllowAmbientCredentials: true})
+	assert.ErrorContains(t, err, "unknown")
+
+	_, err = provider.GetCredentials(&CredentialRequest{Config: &OtcDnsConfig{CsmsSecretName: "otcdns-credentials"}, AllowAmbientCredentials: false})
+	assert.Error(t, err, "The bootstrap identity must not be used without permission for ambient credentials.")
+	assert.Equal(t, 1, calls)
+}
@@ -0,0 +1,149 @@
+package otcdns
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// ===========================================================================
+// Exec credential provider
+// ===========================================================================
+
+const (
+	// The environment variable the exec plugin gets the request in, like KUBERNETES_EXEC_INFO of kubectl.
+	envExecInfo string = "OTCDNS_EXEC_INFO"
+
+	execTimeout time.Duration = 30 * time.Second
+	// Cached credentials are renewed this long before they expire.
+	execExpiryMargin time.Duration = time.Minute
+)
+
+// The request the exec plugin gets in OTCDNS_EXEC_INFO.
+type execCredentialInfo struct {
+	Namespace   string            `json:"namespace"`
+	AuthURL     string            `json:"authURL"`
+	Region      string            `json:"region"`
+	AuthType    string            `json:"authType"`
+	ProjectID   string            `json:"projectID,omitempty"`
+	ProjectName string            `json:"projectName,omitempty"`
+	DomainName  string            `json:"domainName,omitempty"`
+	Args        map[string]string `json:"args,omitempty"`
+}
+
+// Runs an external binary, that writes the credentials as JSON to its standard output.
+// This works like the exec credential plugins of kubectl. The plugin gets the request as JSON in OTCDNS_EXEC_INFO.
+// The command is configured for the webhook with CREDENTIAL_EXEC_COMMAND. Issuers can only select it.
+// Credentials with an expiresAt are cached until shortly before they expire.
+// The command runs with the identity of the webhook. It is only run, when cert-manager allows ambient credentials for the issuer.
+type execCredentialProvider struct {
+	command []string
+
+	mutex sync.Mutex
+	cache map[string]*Credentials
+	// Concurrent requests of the same cache key wait for the running command. The cache is not locked while it runs.
+	running singleflight.Group
+}
+
+func newExecCredentialProvider(command []string) *execCredentialProvider {
+	return &execCredentialProvider{
+		command: command,
+		cache:   map[string]*Credentials{},
+	}
+}
+
+func (p *execCredentialProvider) Name() string {
+	return CredentialProviderExec
+}
+
+func (p *execCredentialProvider) GetCredentials(request *CredentialRequest) (*Credentials, error) {
+	if len(p.command) == 0 {
+		return nil, fmt.Errorf("credentialProvider %q requires %s of the webhook", CredentialProviderExec, envCredentialExecCommand)
+	}
+	if !request.AllowAmbientCredentials {
+		return nil, fmt.Errorf("credentialProvider %q runs the command of the webhook, but ambient credentials are not allowed for this issuer", CredentialProviderExec)
+	}
+
+	config := request.Config
+	execInfo, err := json.Marshal(execCredentialInfo{
+		Namespace:   request.Namespace,
+		AuthURL:     config.AuthURL,
+		Region:      config.Region,
+		AuthType:    config.AuthType,
+		ProjectID:   config.ProjectID,
+		ProjectName: config.ProjectName,
+		DomainName:  config.DomainName,
+		Args:        config.CredentialProviderArgs,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot encode exec info. %s", err)
+	}
+
+	cacheKey := string(execInfo)
+	if credentials := p.getCached(cacheKey); credentials != nil {
+		return credentials, nil
+	}
+
+	result, err, _ := p.running.Do(cacheKey, func() (interface{}, error) {
+		credentials, err := p.run(execInfo)
+		if err != nil {
+			return nil, err
+		}
+		if credentials.ExpiresAt != nil {
+			p.mutex.Lock()
+			p.cache[cacheKey] = credentials
+			p.mutex.Unlock()
+		}
+		return credentials, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.(*Credentials), nil
+}
+
+// Returns the cached credentials of the given key. Returns nil, when there are none or when they are about to expire.
+func (p *execCredentialProvider) getCached(cacheKey string) *Credentials {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	credentials, ok := p.cache[cacheKey]
+	if !ok {
+		return nil
+	}
+	if time.Now().Add(execExpiryMargin).Before(*credentials.ExpiresAt) {
+		return credentials
+	}
+	delete(p.cache, cacheKey)
+	return nil
+}
+
+// Runs the command and decodes the credentials from its output.
+func (p *execCredentialProvider) run(execInfo []byte) (*Credentials, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), execTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, p.command[0], p.command[1:]...)
+	cmd.Env = append(os.Environ(), envExecInfo+"="+string(execInfo))
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("exec plugin %s failed. %s: %s", p.command[0], err, strings.TrimSpace(stderr.String()))
+	}
+
+	credentials := &Credentials{}
+	if err := json.Unmarshal(stdout.Bytes(), credentials); err != nil {
+		return nil, fmt.Errorf("cannot decode output of exec plugin %s. %s", p.command[0], err)
+	}
+	return credentials, nil
+}
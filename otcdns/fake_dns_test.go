@@ -0,0 +1,399 @@
+// The fake OTC DNS API of the tests, that run without access to the OTC.
+package otcdns
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	otc "github.com/opentelekomcloud/gophertelekomcloud"
+	"github.com/opentelekomcloud/gophertelekomcloud/openstack/common/tags"
+)
+
+// A zone of the fake DNS API.
+type fakeZone struct {
+	ID        string              `json:"id"`
+	Name      string              `json:"name"`
+	ZoneType  string              `json:"zone_type"`
+	ProjectID string              `json:"project_id,omitempty"`
+	Routers   []map[string]string `json:"routers,omitempty"`
+}
+
+// A recordset of the fake DNS API.
+type fakeRecordSet struct {
+	ID          string   `json:"id"`
+	ZoneID      string   `json:"zone_id"`
+	Name        string   `json:"name"`
+	Type        string   `json:"type"`
+	TTL         int      `json:"ttl"`
+	Description string   `json:"description"`
+	Records     []string `json:"records"`
+	Status      string   `json:"status"`
+	// The tags are not part of the recordset in the API. They are read with the tags API.
+	Tags map[string]string `json:"-"`
+}
+
+// A request the fake DNS API received.
+type fakeRequest struct {
+	Method string
+	Path   string
+	Query  url.Values
+	Header http.Header
+	Body   []byte
+}
+
+// A fake OTC DNS API, that keeps its zones and recordsets in memory.
+// Zones are listed by name and zone type, recordsets by name, type and tags.
+// Created, updated and deleted recordsets are pending, until their status is read.
+type fakeDns struct {
+	*httptest.Server
+	t *testing.T
+
+	mutex      sync.Mutex
+	zones      []fakeZone
+	recordSets []*fakeRecordSet
+	deleted    map[string]bool
+	requests   []fakeRequest
+	nextID     int
+
+	// Optional statuses the reads of a single recordset return one after the other. The last status is repeated.
+	// The status "" answers with 404. Without statuses a recordset is ACTIVE, when it is read, and deleted recordsets are gone.
+	pollStatuses []string
+
+	// Optional. Returns a status code, that replaces the response of the fake, e.g. to simulate failures.
+	// The request changes the state of the fake nevertheless, as if only the response was lost. 0 keeps the response.
+	failWith func(w http.ResponseWriter, r *http.Request) int
+}
+
+func newFakeDns(t *testing.T, zones ...fakeZone) *fakeDns {
+	f := &fakeDns{t: t, zones: zones, deleted: map[string]bool{}}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.serveHTTP))
+	t.Cleanup(f.Close)
+	return f
+}
+
+// Creates a client for the fake DNS API. The client is not authenticated.
+func newFakeDnsClient(endpoint string) *OtcDnsClient {
+	providerClient := &otc.ProviderClient{}
+	providerClient.UseTokenLock()
+	providerClient.SetToken("token")
+	return &OtcDnsClient{
+		Sc: &otc.ServiceClient{
+			ProviderClient: providerClient,
+			Endpoint:       endpoint + "/",
+		},
+	}
+}
+
+// Creates a client for this fake DNS API.
+func (f *fakeDns) client() *OtcDnsClient {
+	return newFakeDnsClient(f.URL)
+}
+
+// Adds a recordset to the fake and returns it.
+func (f *fakeDns) addRecordSet(recordSet fakeRecordSet) *fakeRecordSet {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if recordSet.ID == "" {
+		recordSet.ID = f.newID()
+	}
+	if recordSet.Type == "" {
+		recordSet.Type = dnsRecordTypeTxt
+	}
+	if recordSet.Status == "" {
+		recordSet.Status = recordSetStatusActive
+	}
+	f.recordSets = append(f.recordSets, &recordSet)
+	return &recordSet
+}
+
+// Returns the recordsets of the fake.
+func (f *fakeDns) getRecordSets() []fakeRecordSet {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	recordSets := make([]fakeRecordSet, 0, len(f.recordSets))
+	for _, recordSet := range f.recordSets {
+		recordSets = append(recordSets, *recordSet)
+	}
+	return recordSets
+}
+
+// Returns the requests with the given method and path, e.g. "POST /zones/zone/recordsets".
+func (f *fakeDns) getRequests(methodAndPath string) []fakeRequest {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	var requests []fakeRequest
+	for _, request := range f.requests {
+		if request.Method+" "+request.Path == methodAndPath {
+			requests = append(requests, request)
+		}
+	}
+	return requests
+}
+
+func (f *fakeDns) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	// The clients authenticated at the fake IAM use the versioned endpoint of the service catalog.
+	r.URL.Path = strings.TrimPrefix(r.URL.Path, "/v2")
+	f.mutex.Lock()
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		f.t.Errorf("Unable to read request: %v", err)
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	f.requests = append(f.requests, fakeRequest{Method: r.Method, Path: r.URL.Path, Query: r.URL.Query(), Header: r.Header.Clone(), Body: body})
+	f.mutex.Unlock()
+
+	response := httptest.NewRecorder()
+	f.handle(response, r)
+
+	if f.failWith != nil {
+		if statusCode := f.failWith(w, r); statusCode != 0 {
+			w.WriteHeader(statusCode)
+			return
+		}
+	}
+	for key, values := range response.Header() {
+		w.Header()[key] = values
+	}
+	w.WriteHeader(response.Code)
+	_, _ = w.Write(response.Body.Bytes())
+}
+
+func (f *fakeDns) handle(w http.ResponseWriter, r *http.Request) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+
+	path := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case len(path) == 1 && path[0] == "zones" && r.Method == http.MethodGet:
+		f.writeJson(w, http.StatusOK, map[string]interface{}{"zones": f.listZones(r.URL.Query())})
+	case len(path) == 2 && path[0] == "zones" && r.Method == http.MethodGet:
+		for _, zone := range f.zones {
+			if zone.ID == path[1] {
+				f.writeJson(w, http.StatusOK, zone)
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNotFound)
+	case len(path) == 1 && path[0] == "recordsets" && r.Method == http.MethodGet:
+		f.writeJson(w, http.StatusOK, map[string]interface{}{"recordsets": f.listRecordSets("", r.URL.Query())})
+	case len(path) == 3 && path[0] == "zones" && path[2] == "recordsets":
+		switch r.Method {
+		case http.MethodGet:
+			f.writeJson(w, http.StatusOK, map[string]interface{}{"recordsets": f.listRecordSets(path[1], r.URL.Query())})
+		case http.MethodPost:
+			f.createRecordSet(w, r, path[1])
+		}
+	case len(path) == 4 && path[0] == "zones" && path[2] == "recordsets":
+		f.handleRecordSet(w, r, path[3])
+	case len(path) == 4 && strings.HasPrefix(path[1], "DNS-") && path[3] == "tags" && r.Method == http.MethodGet:
+		f.getTags(w, path[2])
+	case len(path) == 5 && strings.HasPrefix(path[1], "DNS-") && path[3] == "tags" && path[4] == "action":
+		f.tagAction(w, r, path[2])
+	default:
+		f.t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// Lists the zones with the name and the zone type of the query. The API lists the public zones without a type.
+func (f *fakeDns) listZones(query url.Values) []fakeZone {
+	zoneType := query.Get("type")
+	if zoneType == "" {
+		zoneType = ZoneTypePublic
+	}
+	zones := []fakeZone{}
+	for _, zone := range f.zones {
+		zoneZoneType := zone.ZoneType
+		if zoneZoneType == "" {
+			zoneZoneType = ZoneTypePublic
+		}
+		if zoneZoneType != zoneType || query.Get("name") != "" && !strings.EqualFold(zone.Name, query.Get("name")) {
+			continue
+		}
+		zones = append(zones, zone)
+	}
+	return zones
+}
+
+// Lists the recordsets of the given zone, or of all zones, with the name, the type and the tags of the query.
+func (f *fakeDns) listRecordSets(zoneID string, query url.Values) []fakeRecordSet {
+	recordSets := []fakeRecordSet{}
+	for _, recordSet := range f.recordSets {
+		if zoneID != "" && recordSet.ZoneID != zoneID ||
+			query.Get("name") != "" && !strings.EqualFold(recordSet.Name, query.Get("name")) ||
+			query.Get("type") != "" && recordSet.Type != query.Get("type") ||
+			!hasFakeTags(recordSet, query.Get("tags")) {
+			continue
+		}
+		recordSets = append(recordSets, *recordSet)
+	}
+	return recordSets
+}
+
+// Tests, if the recordset has all tags of the filter "key1,value1|key2,value2".
+func hasFakeTags(recordSet *fakeRecordSet, filter string) bool {
+	if filter == "" {
+		return true
+	}
+	for _, tag := range strings.Split(filter, "|") {
+		key, value, _ := strings.Cut(tag, ",")
+		if recordSet.Tags[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *fakeDns) createRecordSet(w http.ResponseWriter, r *http.Request, zoneID string) {
+	var createOpts struct {
+		fakeRecordSet
+		Tags []tags.ResourceTag `json:"tags"`
+	}
+	f.readJson(r, &createOpts)
+	recordSet := createOpts.fakeRecordSet
+	recordSet.ID = f.newID()
+	recordSet.ZoneID = zoneID
+	recordSet.Status = "PENDING_CREATE"
+	recordSet.Tags = map[string]string{}
+	for _, tag := range createOpts.Tags {
+		recordSet.Tags[tag.Key] = tag.Value
+	}
+	f.recordSets = append(f.recordSets, &recordSet)
+	f.writeJson(w, http.StatusAccepted, recordSet)
+}
+
+func (f *fakeDns) handleRecordSet(w http.ResponseWriter, r *http.Request, recordSetID string) {
+	recordSet, i := f.findRecordSet(recordSetID)
+	switch r.Method {
+	case http.MethodGet:
+		f.pollRecordSet(w, recordSet, recordSetID)
+	case http.MethodPut:
+		if recordSet == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		var updateOpts fakeRecordSet
+		f.readJson(r, &updateOpts)
+		recordSet.Records = updateOpts.Records
+		recordSet.Status = "PENDING_UPDATE"
+		f.writeJson(w, http.StatusAccepted, recordSet)
+	case http.MethodDelete:
+		if recordSet == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		f.recordSets = append(f.recordSets[:i], f.recordSets[i+1:]...)
+		f.deleted[recordSetID] = true
+		recordSet.Status = "PENDING_DELETE"
+		f.writeJson(w, http.StatusAccepted, recordSet)
+	}
+}
+
+// Returns the status of a recordset. The pending changes are applied with the read.
+func (f *fakeDns) pollRecordSet(w http.ResponseWriter, recordSet *fakeRecordSet, recordSetID string) {
+	if len(f.pollStatuses) > 0 {
+		status := f.pollStatuses[0]
+		if len(f.pollStatuses) > 1 {
+			f.pollStatuses = f.pollStatuses[1:]
+		}
+		if status == "" || recordSet == nil && !f.deleted[recordSetID] {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if recordSet == nil {
+			recordSet = &fakeRecordSet{ID: recordSetID}
+		}
+		recordSet.Status = status
+		f.writeJson(w, http.StatusOK, recordSet)
+		return
+	}
+	if recordSet == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	recordSet.Status = recordSetStatusActive
+	f.writeJson(w, http.StatusOK, recordSet)
+}
+
+func (f *fakeDns) getTags(w http.ResponseWriter, recordSetID string) {
+	recordSet, _ := f.findRecordSet(recordSetID)
+	if recordSet == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	resourceTags := []tags.ResourceTag{}
+	for _, key := range sortedTagKeys(recordSet.Tags) {
+		resourceTags = append(resourceTags, tags.ResourceTag{Key: key, Value: recordSet.Tags[key]})
+	}
+	f.writeJson(w, http.StatusOK, map[string]interface{}{"tags": resourceTags})
+}
+
+// Creates or deletes the tags of a recordset. A created tag replaces the value of an existing tag.
+func (f *fakeDns) tagAction(w http.ResponseWriter, r *http.Request, recordSetID string) {
+	recordSet, _ := f.findRecordSet(recordSetID)
+	if recordSet == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	var actionOpts tags.ActionOpts
+	f.readJson(r, &actionOpts)
+	if recordSet.Tags == nil {
+		recordSet.Tags = map[string]string{}
+	}
+	for _, tag := range actionOpts.Tags {
+		if actionOpts.Action == "delete" {
+			delete(recordSet.Tags, tag.Key)
+		} else {
+			recordSet.Tags[tag.Key] = tag.Value
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (f *fakeDns) findRecordSet(recordSetID string) (*fakeRecordSet, int) {
+	for i, recordSet := range f.recordSets {
+		if recordSet.ID == recordSetID {
+			return recordSet, i
+		}
+	}
+	return nil, -1
+}
+
+func (f *fakeDns) newID() string {
+	f.nextID++
+	return fmt.Sprintf("recordset-%d", f.nextID)
+}
+
+func (f *fakeDns) readJson(r *http.Request, v interface{}) {
+	body, err := io.ReadAll(r.Body)
+	if err == nil {
+		err = json.Unmarshal(body, v)
+	}
+	if err != nil {
+		f.t.Errorf("invalid request body of %s %s: %s", r.Method, r.URL.Path, err)
+	}
+}
+
+func (f *fakeDns) writeJson(w http.ResponseWriter, statusCode int, v interface{}) {
+	w.WriteHeader(statusCode)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// Makes the requests hang, until they are cancelled.
+func hangUntilCancelled(w http.ResponseWriter, r *http.Request) int {
+	select {
+	case <-r.Context().Done():
+	case <-time.After(10 * time.Second):
+	}
+	return http.StatusGatewayTimeout
+}
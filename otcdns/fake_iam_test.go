@@ -0,0 +1,201 @@
+// A fake IAM, that authenticates the DNS clients in the tests.
+package otcdns
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	extapi "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+)
+
+// A fake IAM API. It serves the service catalog and the domain for the AK/SK authentication,
+// validates pre-issued tokens and issues tokens for the password and the assume role authentication.
+type fakeIam struct {
+	*httptest.Server
+	t *testing.T
+	// The endpoint of the DNS in the service catalog.
+	dnsEndpoint string
+
+	mutex sync.Mutex
+	// The number of authentications.
+	authentications int
+	// The token requests the fake IAM received.
+	tokenRequests []fakeTokenRequest
+	// Optional. The time the issued and the validated tokens expire. 24 hours from now, when it is zero.
+	tokenExpiresAt time.Time
+}
+
+// A request for a token the fake IAM received.
+type fakeTokenRequest struct {
+	// The token the request was authenticated with, e.g. to assume an agency.
+	AuthToken string
+	// The "auth" object of the request.
+	Auth map[string]interface{}
+}
+
+// Starts a fake IAM, that is stopped at the end of the test.
+// The service catalog points to the given fake DNS. It may be nil, when the test does not call the DNS.
+func newFakeIam(t *testing.T, dns *fakeDns) *fakeIam {
+	f := &fakeIam{t: t}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.serveHTTP))
+	t.Cleanup(f.Close)
+	f.dnsEndpoint = f.URL + "/dns/"
+	if dns != nil {
+		f.dnsEndpoint = dns.URL + "/"
+	}
+	return f
+}
+
+// Returns a solver configuration, that authenticates at the fake IAM with the inline keys of the configuration.
+func (f *fakeIam) solverConfig(t *testing.T, config map[string]interface{}) *extapi.JSON {
+	solverConfig := map[string]interface{}{
+		"authURL":   f.authURL(),
+		"region":    "eu-de",
+		"projectID": "project-id",
+		"accessKey": "ak",
+		"secretKey": "sk",
+	}
+	for key, value := range config {
+		solverConfig[key] = value
+	}
+	raw, err := json.Marshal(solverConfig)
+	if err != nil {
+		t.Fatalf("Unable to marshal solver config: %v", err)
+	}
+	return &extapi.JSON{Raw: raw}
+}
+
+// The identity endpoint of the fake IAM.
+func (f *fakeIam) authURL() string {
+	return f.URL + "/v3/"
+}
+
+// Returns the token requests so far.
+func (f *fakeIam) getTokenRequests() []fakeTokenRequest {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return append([]fakeTokenRequest(nil), f.tokenRequests...)
+}
+
+// Returns the number of authentications so far.
+func (f *fakeIam) getAuthentications() int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.authentications
+}
+
+func (f *fakeIam) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/v3/auth/catalog":
+		f.authentications++
+		f.writeJson(w, http.StatusOK, map[string]interface{}{"catalog": f.catalog()})
+	case r.Method == http.MethodGet && r.URL.Path == "/v3/auth/domains":
+		f.listDomains(w, r)
+	case r.Method == http.MethodPost && r.URL.Path == "/v3/auth/tokens":
+		f.authentications++
+		f.issueToken(w, r)
+	case r.Method == http.MethodGet && r.URL.Path == "/v3/auth/tokens":
+		f.authentications++
+		f.validateToken(w, r)
+	default:
+		f.t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// Issues the token "token-<n>" for the n-th authentication. The token is scoped to the project of the request.
+// The project ID defaults to "project-id", when the request names the project only.
+func (f *fakeIam) issueToken(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Auth map[string]interface{} `json:"auth"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		f.t.Errorf("Unable to decode token request: %v", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	f.tokenRequests = append(f.tokenRequests, fakeTokenRequest{AuthToken: r.Header.Get("X-Auth-Token"), Auth: request.Auth})
+
+	project := map[string]interface{}{"id": "project-id", "name": "eu-de", "domain": map[string]interface{}{"id": "domain-id", "name": "domain"}}
+	if scope, ok := request.Auth["scope"].(map[string]interface{}); ok {
+		if scopedProject, ok := scope["project"].(map[string]interface{}); ok {
+			for _, key := range []string{"id", "name"} {
+				if value, ok := scopedProject[key].(string); ok {
+					project[key] = value
+				}
+			}
+		}
+	}
+
+	w.Header().Set("X-Subject-Token", fmt.Sprintf("token-%d", f.authentications))
+	f.writeJson(w, http.StatusCreated, f.token(project))
+}
+
+// Validates the pre-issued token of the request. Every token is valid. It is scoped to the project "project-id".
+func (f *fakeIam) validateToken(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("X-Subject-Token", r.Header.Get("X-Subject-Token"))
+	f.writeJson(w, http.StatusOK, f.token(map[string]interface{}{"id": "project-id", "name": "eu-de", "domain": map[string]interface{}{"id": "domain-id", "name": "domain"}}))
+}
+
+// The body of an issued or a validated token, that is scoped to the given project.
+func (f *fakeIam) token(project map[string]interface{}) map[string]interface{} {
+	expiresAt := f.tokenExpiresAt
+	if expiresAt.IsZero() {
+		expiresAt = time.Now().Add(24 * time.Hour)
+	}
+	return map[string]interface{}{"token": map[string]interface{}{
+		"expires_at": expiresAt.UTC().Format(time.RFC3339),
+		"methods":    []string{"password"},
+		"catalog":    f.catalog(),
+		"project":    project,
+		"user":       map[string]interface{}{"id": "user-id", "name": "user", "domain": map[string]interface{}{"id": "domain-id", "name": "domain"}},
+	}}
+}
+
+// Lists the domain "domain-of-<access key>" for the access key, that signed the request.
+func (f *fakeIam) listDomains(w http.ResponseWriter, r *http.Request) {
+	match := accessKeyPattern.FindStringSubmatch(r.Header.Get("Authorization"))
+	if match == nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	f.writeJson(w, http.StatusOK, map[string]interface{}{"domains": []map[string]interface{}{{
+		"id":      "domain-of-" + match[1],
+		"name":    "domain-of-" + match[1],
+		"enabled": true,
+	}}})
+}
+
+// The access key of the signature of a request.
+var accessKeyPattern = regexp.MustCompile(`Credential=([^/]+)/`)
+
+// The service catalog with the DNS endpoint of the region eu-de.
+func (f *fakeIam) catalog() []map[string]interface{} {
+	return []map[string]interface{}{{
+		"type": "dns",
+		"name": "dns",
+		"endpoints": []map[string]interface{}{{
+			"interface": "public",
+			"region":    "eu-de",
+			"region_id": "eu-de",
+			"url":       f.dnsEndpoint,
+		}},
+	}}
+}
+
+func (f *fakeIam) writeJson(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		f.t.Errorf("Unable to write response: %v", err)
+	}
+}
@@ -0,0 +1,160 @@
+package otcdns
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// ===========================================================================
+// Workload identity federation
+// ===========================================================================
+
+const (
+	// The header that selects the identity provider of the OTC IAM the ID token is exchanged with.
+	idpIDHeader string = "X-Idp-Id"
+	// The header the OTC IAM returns the issued token in.
+	subjectTokenHeader string = "X-Subject-Token"
+	// The path of the token exchange, relative to the IAM endpoint without the version.
+	idTokenExchangePath string = "/v3.0/OS-AUTH/id-token/tokens"
+
+	idTokenExchangeTimeout time.Duration = 30 * time.Second
+)
+
+// The scope of the token issued for an ID token.
+// The token is scoped to the project, if a project ID or name is given. Otherwise it is scoped to the domain.
+type idTokenScope struct {
+	ProjectID   string
+	ProjectName string
+	DomainID    string
+}
+
+// Exchanges OpenID Connect ID tokens, e.g. projected Kubernetes service account tokens, for IAM tokens.
+// The OTC IAM must trust the issuer of the ID tokens with an OpenID Connect identity provider.
+// https://docs.otc.t-systems.com/identity-access-management/api-ref/apis/federated_identity_authentication_management/obtaining_a_token_with_an_openid_connect_id_token.html
+type idTokenExchanger struct {
+	httpClient *http.Client
+}
+
+func newIdTokenExchanger() *idTokenExchanger {
+	return &idTokenExchanger{
+		httpClient: &http.Client{Timeout: idTokenExchangeTimeout},
+	}
+}
+
+// The request body of the token exchange.
+type idTokenAuthRequest struct {
+	Auth idTokenAuth `json:"auth"`
+}
+
+type idTokenAuth struct {
+	IdToken idTokenID         `json:"id_token"`
+	Scope   *idTokenAuthScope `json:"scope,omitempty"`
+}
+
+type idTokenID struct {
+	ID string `json:"id"`
+}
+
+type idTokenAuthScope struct {
+	Project *idTokenAuthScopeItem `json:"project,omitempty"`
+	Domain  *idTokenAuthScopeItem `json:"domain,omitempty"`
+}
+
+type idTokenAuthScopeItem struct {
+	ID   string `json:"id,omitempty"`
+	Name string `json:"name,omitempty"`
+}
+
+// The response body of the token exchange. Only the expiry is of interest, the token itself is returned in a header.
+type idTokenAuthResponse struct {
+	Token struct {
+		ExpiresAt time.Time `json:"expires_at"`
+	} `json:"token"`
+}
+
+// Exchanges the given ID token for an IAM token.
+// Returns the token and the time it expires.
+//
+// authURL: The IAM endpoint, e.g. https://iam.eu-de.otc.t-systems.com:443/v3
+// idpID: The ID of the identity provider in the IAM, that trusts the issuer of the ID token.
+func (e *idTokenExchanger) Exchange(authURL string, idpID string, idToken string, scope idTokenScope) (string, time.Time, error) {
+	body, err := json.Marshal(idTokenAuthRequest{
+		Auth: idTokenAuth{
+			IdToken: idTokenID{ID: idToken},
+			Scope:   scope.toAuthScope(),
+		},
+	})
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("cannot encode token exchange request. %s", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, getIdTokenExchangeURL(authURL), bytes.NewReader(body))
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("cannot create token exchange request. %s", err)
+	}
+	req.Header.Set("Content-Type", "application/json;charset=utf8")
+	req.Header.Set(idpIDHeader, idpID)
+
+	resp, err := e.httpClient.Do(req)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("token exchange failed. %s", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("cannot read token exchange response. %s", err)
+	}
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		return "", time.Time{}, fmt.Errorf("token exchange with identity provider %q failed with status %d: %s", idpID, resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+
+	token := resp.Header.Get(subjectTokenHeader)
+	if token == "" {
+		return "", time.Time{}, fmt.Errorf("token exchange response has no %s header", subjectTokenHeader)
+	}
+
+	var authResp idTokenAuthResponse
+	if err := json.Unmarshal(respBody, &authResp); err != nil {
+		return "", time.Time{}, fmt.Errorf("cannot decode token exchange response. %s", err)
+	}
+
+	return token, authResp.Token.ExpiresAt, nil
+}
+
+// Builds the scope of the token exchange request. Returns nil for an unscoped token.
+func (scope idTokenScope) toAuthScope() *idTokenAuthScope {
+	switch {
+	case scope.ProjectID != "":
+		return &idTokenAuthScope{Project: &idTokenAuthScopeItem{ID: scope.ProjectID}}
+	case scope.ProjectName != "":
+		return &idTokenAuthScope{Project: &idTokenAuthScopeItem{Name: scope.ProjectName}}
+	case scope.DomainID != "":
+		return &idTokenAuthScope{Domain: &idTokenAuthScopeItem{ID: scope.DomainID}}
+	default:
+		return nil
+	}
+}
+
+// The token exchange is a v3.0 API of the IAM. The auth URL usually points to the v3 API.
+func getIdTokenExchangeURL(authURL string) string {
+	baseURL := strings.TrimSuffix(authURL, "/")
+	baseURL = strings.TrimSuffix(baseURL, "/v3")
+	return baseURL + idTokenExchangePath
+}
+
+// Reads the ID token of the webhook from the given file.
+// The kubelet rotates projected service account tokens. The file is read for every exchange.
+func readIdToken(tokenFile string) (string, error) {
+	idToken, err := os.ReadFile(tokenFile)
+	if err != nil {
+		return "", fmt.Errorf("cannot read ID token. %s", err)
+	}
+	return strings.TrimSpace(string(idToken)), nil
+}
@@ -0,0 +1,98 @@
+// The tests in this file test the token exchange of the workload identity federation against a fake IAM.
+package otcdns
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// A fake IAM, that issues a token for the ID token "valid-id-token" of the identity provider "kubernetes".
+func newFakeIAM(t *testing.T, expiresAt time.Time) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, idTokenExchangePath, r.URL.Path)
+
+		var authRequest idTokenAuthRequest
+		if err := json.NewDecoder(r.Body).Decode(&authRequest); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if r.Header.Get(idpIDHeader) != "kubernetes" || authRequest.Auth.IdToken.ID != "valid-id-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"error": {"code": 401, "message": "The request you have made requires authentication."}}`))
+			return
+		}
+		if assert.NotNil(t, authRequest.Auth.Scope) && assert.NotNil(t, authRequest.Auth.Scope.Project) {
+			assert.Equal(t, "project-id", authRequest.Auth.Scope.Project.ID, "The token must be scoped to the project.")
+		}
+
+		w.Header().Set(subjectTokenHeader, "scoped-iam-token")
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"token": map[string]interface{}{"expires_at": expiresAt.Format(time.RFC3339)},
+		})
+	}))
+}
+
+// Tests, if an ID token is exchanged for a scoped IAM token.
+func TestIdTokenExchange(t *testing.T) {
+	expiresAt := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	iam := newFakeIAM(t, expiresAt)
+	defer iam.Close()
+
+	token, tokenExpiresAt, err := newIdTokenExchanger().Exchange(iam.URL+"/v3", "kubernetes", "valid-id-token", idTokenScope{ProjectID: "project-id"})
+	if err != nil {
+		t.Fatalf("Unable to exchange ID token: %v", err)
+	}
+	assert.Equal(t, "scoped-iam-token", token)
+	assert.True(t, expiresAt.Equal(tokenExpiresAt), "The expiry of the token must be returned.")
+}
+
+// Tests, that a rejected ID token is reported.
+func TestIdTokenExchangeRejected(t *testing.T) {
+	iam := newFakeIAM(t, time.Now().Add(time.Hour))
+	defer iam.Close()
+
+	_, _, err := newIdTokenExchanger().Exchange(iam.URL+"/v3", "kubernetes", "forged-id-token", idTokenScope{ProjectID: "project-id"})
+	assert.ErrorContains(t, err, "status 401")
+}
+
+// Tests, if the ID token of the webhook is read from the projected token file.
+func TestReadIdToken(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "otc-token")
+	if err := os.WriteFile(tokenFile, []byte("valid-id-token\n"), 0600); err != nil {
+		t.Fatalf("Unable to write token file: %v", err)
+	}
+
+	idToken, err := readIdToken(tokenFile)
+	if err != nil {
+		t.Fatalf("Unable to read token file: %v", err)
+	}
+	assert.Equal(t, "valid-id-token", idToken)
+}
+
+// Tests, if the exchanged token is scoped to the project ID, the project name or the domain ID, in this order.
+func TestIdTokenScope(t *testing.T) {
+	assert.Equal(t, &idTokenAuthScope{Project: &idTokenAuthScopeItem{ID: "project-id"}}, idTokenScope{ProjectID: "project-id", ProjectName: "eu-de", DomainID: "domain-id"}.toAuthScope())
+	assert.Equal(t, &idTokenAuthScope{Project: &idTokenAuthScopeItem{Name: "eu-de"}}, idTokenScope{ProjectName: "eu-de", DomainID: "domain-id"}.toAuthScope())
+	assert.Equal(t, &idTokenAuthScope{Domain: &idTokenAuthScopeItem{ID: "domain-id"}}, idTokenScope{DomainID: "domain-id"}.toAuthScope())
+	assert.Nil(t, idTokenScope{}.toAuthScope())
+}
+
+// Tests, that the domain of AK/SK credentials is not taken for the scope of the exchanged token.
+func TestIdTokenRejectsDomainName(t *testing.T) {
+	solver := NewSolver().(*OtcDnsSolver)
+	_, err := solver.getOtcDnsClientFromConfig(&OtcDnsConfig{
+		AuthType:           AuthTypeOIDC,
+		IdentityProviderID: "kubernetes",
+		DomainName:         "domain",
+	}, "cert-manager", true)
+	assert.ErrorContains(t, err, "Set domainID")
+}
@@ -0,0 +1,188 @@
+package otcdns
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmclient "github.com/cert-manager/cert-manager/pkg/client/clientset/versioned"
+	extapi "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+	"k8s.io/klog"
+)
+
+// ===========================================================================
+// Issuer health
+// ===========================================================================
+
+var (
+	// 1, if the last preflight check of the solver configuration succeeded. 0 otherwise.
+	issuerPreflightSuccess = metrics.NewGaugeVec(&metrics.GaugeOpts{
+		Namespace:      "otcdns",
+		Name:           "issuer_preflight_success",
+		Help:           "1, if the last preflight check of the OTC DNS solver configuration of the issuer succeeded. 0 otherwise.",
+		StabilityLevel: metrics.ALPHA,
+	}, []string{"kind", "namespace", "name", "solver"})
+
+	// The time of the last preflight check of the solver configuration.
+	issuerPreflightLastCheck = metrics.NewGaugeVec(&metrics.GaugeOpts{
+		Namespace:      "otcdns",
+		Name:           "issuer_preflight_last_check_timestamp_seconds",
+		Help:           "Unix time of the last preflight check of the OTC DNS solver configuration of the issuer.",
+		StabilityLevel: metrics.ALPHA,
+	}, []string{"kind", "namespace", "name", "solver"})
+
+	registerIssuerMetrics sync.Once
+)
+
+// A solver configuration of an Issuer or ClusterIssuer that references this webhook.
+type issuerSolverRef struct {
+	Kind      string
+	Namespace string
+	Name      string
+	// The index of the solver in the ACME solvers of the issuer.
+	SolverIndex int
+	Config      *extapi.JSON
+	// The namespace the secrets are loaded from. The namespace of an Issuer or the cluster resource namespace for a ClusterIssuer.
+	ResourceNamespace       string
+	AllowAmbientCredentials bool
+}
+
+// The metric labels of the solver configuration.
+func (ref issuerSolverRef) labels() map[string]string {
+	return map[string]string{
+		"kind":      ref.Kind,
+		"namespace": ref.Namespace,
+		"name":      ref.Name,
+		"solver":    strconv.Itoa(ref.SolverIndex),
+	}
+}
+
+// Checks the solver configurations of all Issuers and ClusterIssuers that reference this webhook periodically.
+// The result is reported with the otcdns_issuer_preflight_* metrics.
+type issuerHealthChecker struct {
+	cmClient                 cmclient.Interface
+	groupName                string
+	solverName               string
+	clusterResourceNamespace string
+	interval                 time.Duration
+	preflight                func(cfgJSON *extapi.JSON, namespace string, allowAmbientCredentials bool) error
+
+	// The metric labels reported by the last check. Used to remove the metrics of deleted issuers.
+	reported map[string]map[string]string
+}
+
+func newIssuerHealthChecker(cmClient cmclient.Interface, solver *OtcDnsSolver, interval time.Duration) *issuerHealthChecker {
+	registerIssuerMetrics.Do(func() {
+		legacyregistry.MustRegister(issuerPreflightSuccess, issuerPreflightLastCheck)
+	})
+
+	return &issuerHealthChecker{
+		cmClient:                 cmClient,
+		groupName:                getGroupName(),
+		solverName:               solver.Name(),
+		clusterResourceNamespace: getClusterResourceNamespace(),
+		interval:                 interval,
+		preflight:                solver.Preflight,
+		reported:                 map[string]map[string]string{},
+	}
+}
+
+// Runs the checks until the stop channel is closed.
+func (c *issuerHealthChecker) Run(stopCh <-chan struct{}) {
+	klog.Infof("checking the solver configurations of the issuers every %s", c.interval)
+	wait.Until(c.checkAll, c.interval, stopCh)
+}
+
+// Checks the solver configurations of all Issuers and ClusterIssuers once.
+func (c *issuerHealthChecker) checkAll() {
+	refs, err := c.listSolverRefs(context.Background())
+	if err != nil {
+		klog.Errorf("cannot list the issuers for the preflight check. %s", err)
+		return
+	}
+
+	current := map[string]map[string]string{}
+	for _, ref := range refs {
+		labels := ref.labels()
+		current[fmt.Sprintf("%s/%s/%s/%d", ref.Kind, ref.Namespace, ref.Name, ref.SolverIndex)] = labels
+
+		err := c.preflight(ref.Config, ref.ResourceNamespace, ref.AllowAmbientCredentials)
+		if err != nil {
+			klog.Errorf("preflight check of %s %s solver %d failed. %s", ref.Kind, ref.Namespace+"/"+ref.Name, ref.SolverIndex, err)
+			issuerPreflightSuccess.With(labels).Set(0)
+		} else {
+			klog.Infof("preflight check of %s %s solver %d succeeded", ref.Kind, ref.Namespace+"/"+ref.Name, ref.SolverIndex)
+			issuerPreflightSuccess.With(labels).Set(1)
+		}
+		issuerPreflightLastCheck.With(labels).SetToCurrentTime()
+	}
+
+	// Remove the metrics of deleted issuers.
+	for key, labels := range c.reported {
+		if _, ok := current[key]; !ok {
+			issuerPreflightSuccess.Delete(labels)
+			issuerPreflightLastCheck.Delete(labels)
+		}
+	}
+	c.reported = current
+}
+
+// Lists the solver configurations of all Issuers and ClusterIssuers that reference this webhook.
+func (c *issuerHealthChecker) listSolverRefs(ctx context.Context) ([]issuerSolverRef, error) {
+	var refs []issuerSolverRef
+
+	issuers, err := c.cmClient.CertmanagerV1().Issuers(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("cannot list Issuers. %s", err)
+	}
+	for _, issuer := range issuers.Items {
+		// cert-manager does not allow ambient credentials for Issuers by default.
+		refs = append(refs, c.getSolverRefs(cmapi.IssuerKind, issuer.Namespace, issuer.Name, &issuer.Spec, issuer.Namespace, false)...)
+	}
+
+	clusterIssuers, err := c.cmClient.CertmanagerV1().ClusterIssuers().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("cannot list ClusterIssuers. %s", err)
+	}
+	for _, clusterIssuer := range clusterIssuers.Items {
+		// cert-manager allows ambient credentials for ClusterIssuers by default.
+		refs = append(refs, c.getSolverRefs(cmapi.ClusterIssuerKind, "", clusterIssuer.Name, &clusterIssuer.Spec, c.clusterResourceNamespace, true)...)
+	}
+
+	return refs, nil
+}
+
+// Collects the solvers of the given issuer that reference this webhook.
+func (c *issuerHealthChecker) getSolverRefs(kind string, namespace string, name string, spec *cmapi.IssuerSpec, resourceNamespace string, allowAmbientCredentials bool) []issuerSolverRef {
+	if spec.ACME == nil {
+		return nil
+	}
+
+	var refs []issuerSolverRef
+	for i, solver := range spec.ACME.Solvers {
+		if solver.DNS01 == nil || solver.DNS01.Webhook == nil {
+			continue
+		}
+		webhook := solver.DNS01.Webhook
+		if webhook.GroupName != c.groupName || webhook.SolverName != c.solverName {
+			continue
+		}
+		refs = append(refs, issuerSolverRef{
+			Kind:                    kind,
+			Namespace:               namespace,
+			Name:                    name,
+			SolverIndex:             i,
+			Config:                  webhook.Config,
+			ResourceNamespace:       resourceNamespace,
+			AllowAmbientCredentials: allowAmbientCredentials,
+		})
+	}
+	return refs
+}
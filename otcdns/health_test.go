@@ -0,0 +1,76 @@
+// The tests in this file test the periodic preflight checks of the issuers against a fake cert-manager API.
+package otcdns
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	cmacme "github.com/cert-manager/cert-manager/pkg/apis/acme/v1"
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmfake "github.com/cert-manager/cert-manager/pkg/client/clientset/versioned/fake"
+	"github.com/stretchr/testify/assert"
+	extapi "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/component-base/metrics/testutil"
+)
+
+// Creates an issuer spec with an ACME DNS01 webhook solver.
+func newWebhookIssuerSpec(groupName string, config string) cmapi.IssuerSpec {
+	return cmapi.IssuerSpec{
+		IssuerConfig: cmapi.IssuerConfig{
+			ACME: &cmacme.ACMEIssuer{
+				Solvers: []cmacme.ACMEChallengeSolver{{
+					DNS01: &cmacme.ACMEChallengeSolverDNS01{
+						Webhook: &cmacme.ACMEIssuerDNS01ProviderWebhook{
+							GroupName:  groupName,
+							SolverName: "otcdns",
+							Config:     &extapi.JSON{Raw: []byte(config)},
+						},
+					},
+				}},
+			},
+		},
+	}
+}
+
+// Tests, if the solvers of the issuers that reference the webhook are checked and reported.
+func TestIssuerHealthChecker(t *testing.T) {
+	cmClient := cmfake.NewSimpleClientset(
+		&cmapi.Issuer{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "broken"},
+			Spec:       newWebhookIssuerSpec(defaultGroupName, `{"region": "broken"}`),
+		},
+		&cmapi.Issuer{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "team-b", Name: "other-webhook"},
+			Spec:       newWebhookIssuerSpec("other.example.com", `{}`),
+		},
+		&cmapi.ClusterIssuer{
+			ObjectMeta: metav1.ObjectMeta{Name: "letsencrypt"},
+			Spec:       newWebhookIssuerSpec(defaultGroupName, `{"region": "eu-de"}`),
+		},
+	)
+
+	checker := newIssuerHealthChecker(cmClient, &OtcDnsSolver{}, time.Hour)
+	checked := map[string]bool{}
+	checker.preflight = func(cfgJSON *extapi.JSON, namespace string, allowAmbientCredentials bool) error {
+		config, _ := configJsonToOtcDnsConfig(cfgJSON)
+		checked[namespace] = allowAmbientCredentials
+		if config.Region == "broken" {
+			return fmt.Errorf("authentication failed")
+		}
+		return nil
+	}
+	checker.checkAll()
+
+	assert.Equal(t, map[string]bool{"team-a": false, defaultClusterResourceNamespace: true}, checked,
+		"Only the solvers of this webhook must be checked. ClusterIssuers use the cluster resource namespace and ambient credentials.")
+
+	value, err := testutil.GetGaugeMetricValue(issuerPreflightSuccess.WithLabelValues(cmapi.IssuerKind, "team-a", "broken", "0"))
+	assert.NoError(t, err)
+	assert.Equal(t, 0.0, value, "The failed check must be reported.")
+
+	value, err = testutil.GetGaugeMetricValue(issuerPreflightSuccess.WithLabelValues(cmapi.ClusterIssuerKind, "", "letsencrypt", "0"))
+	assert.NoError(t, err)
+	assert.Equal(t, 1.0, value, "The successful check must be reported.")
+}
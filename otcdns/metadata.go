@@ -0,0 +1,135 @@
+package otcdns
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	credentials3 "github.com/opentelekomcloud/gophertelekomcloud/openstack/identity/v3/credentials"
+	"golang.org/x/sync/singleflight"
+	"k8s.io/klog"
+)
+
+// ===========================================================================
+// Instance metadata agency
+// ===========================================================================
+
+const (
+	// The path of the temporary credentials of the agency attached to the ECS instance.
+	securityKeyPath string = "/openstack/latest/securitykey"
+
+	metadataTimeout time.Duration = 10 * time.Second
+	// The temporary credentials are refreshed this long before they expire.
+	metadataExpiryMargin time.Duration = 10 * time.Minute
+)
+
+// The response of the securitykey endpoint of the metadata service.
+type securityKeyResponse struct {
+	Credential credentials3.TemporaryCredential `json:"credential"`
+}
+
+// Loads the temporary credentials of the agency attached to the ECS instance (e.g. a CCE node) from the metadata service.
+// The credentials are cached and refreshed shortly before they expire.
+// These are credentials of the node. They are only provided, when cert-manager allows ambient credentials for the issuer.
+type metadataCredentialProvider struct {
+	// The endpoint of the metadata service, e.g. http://169.254.169.254
+	endpoint   string
+	httpClient *http.Client
+
+	mutex       sync.Mutex
+	credentials *Credentials
+	// Concurrent requests wait for the running fetch. The cached credentials are not locked while it runs.
+	fetching singleflight.Group
+}
+
+func newMetadataCredentialProvider(endpoint string) *metadataCredentialProvider {
+	return &metadataCredentialProvider{
+		endpoint:   strings.TrimSuffix(endpoint, "/"),
+		httpClient: &http.Client{Timeout: metadataTimeout},
+	}
+}
+
+func (p *metadataCredentialProvider) Name() string {
+	return CredentialProviderMetadata
+}
+
+func (p *metadataCredentialProvider) GetCredentials(request *CredentialRequest) (*Credentials, error) {
+	if !request.AllowAmbientCredentials {
+		return nil, fmt.Errorf("credentialProvider %q uses the agency of the node, but ambient credentials are not allowed for this issuer", CredentialProviderMetadata)
+	}
+
+	if credentials := p.getCached(); credentials != nil {
+		return credentials, nil
+	}
+
+	// The instance has a single agency, so all requests share one fetch.
+	result, err, _ := p.fetching.Do(securityKeyPath, func() (interface{}, error) {
+		credentials, err := p.fetchSecurityKey()
+		if err != nil {
+			return nil, err
+		}
+		klog.Infof("fetched temporary credentials of the instance agency. They expire at %s", credentials.ExpiresAt)
+
+		p.mutex.Lock()
+		p.credentials = credentials
+		p.mutex.Unlock()
+		return credentials, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.(*Credentials), nil
+}
+
+// Returns the cached credentials, unless they are about to expire.
+func (p *metadataCredentialProvider) getCached() *Credentials {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.credentials != nil && time.Now().Add(metadataExpiryMargin).Before(*p.credentials.ExpiresAt) {
+		return p.credentials
+	}
+	return nil
+}
+
+// Fetches the temporary credentials from the metadata service.
+func (p *metadataCredentialProvider) fetchSecurityKey() (*Credentials, error) {
+	resp, err := p.httpClient.Get(p.endpoint + securityKeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("cannot fetch temporary credentials from the metadata service. %s", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read temporary credentials from the metadata service. %s", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		// The metadata service answers with 404, when no agency is attached to the instance.
+		return nil, fmt.Errorf("cannot fetch temporary credentials from the metadata service. Is an agency attached to the instance? Status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var securityKey securityKeyResponse
+	if err := json.Unmarshal(body, &securityKey); err != nil {
+		return nil, fmt.Errorf("cannot decode temporary credentials from the metadata service. %s", err)
+	}
+	credential := securityKey.Credential
+	if credential.AccessKey == "" || credential.SecretKey == "" || credential.SecurityToken == "" {
+		return nil, fmt.Errorf("the metadata service returned incomplete temporary credentials")
+	}
+	expiresAt, err := time.Parse(time.RFC3339, credential.ExpiresAt)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse expiry %q of the temporary credentials. %s", credential.ExpiresAt, err)
+	}
+
+	return &Credentials{
+		AccessKey:     credential.AccessKey,
+		SecretKey:     credential.SecretKey,
+		SecurityToken: credential.SecurityToken,
+		ExpiresAt:     &expiresAt,
+	}, nil
+}
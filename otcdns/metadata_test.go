@@ -0,0 +1,115 @@
+// The tests in this file test the credential provider for the instance metadata agency against a fake metadata server.
+package otcdns
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// A fake metadata server, that issues new temporary credentials with the given lifetime for every request.
+func newFakeMetadataServer(t *testing.T, lifetime time.Duration, calls *int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, securityKeyPath, r.URL.Path)
+		*calls++
+		expiresAt := time.Now().Add(lifetime).UTC().Format("2006-01-02T15:04:05.000000Z")
+		_, _ = fmt.Fprintf(w, `{"credential": {"access": "ak-%d", "secret": "sk-%d", "securitytoken": "token-%d", "expires_at": %q}}`, *calls, *calls, *calls, expiresAt)
+	}))
+}
+
+// Tests, if the temporary credentials are fetched and cached until shortly before they expire.
+func TestMetadataCredentialProvider(t *testing.T) {
+	calls := 0
+	metadata := newFakeMetadataServer(t, time.Hour, &calls)
+	defer metadata.Close()
+
+	provider := newMetadataCredentialProvider(metadata.URL)
+	request := &CredentialRequest{Config: &OtcDnsConfig{}, AllowAmbientCredentials: true}
+
+	credentials, err := provider.GetCredentials(request)
+	if err != nil {
+		t.Fatalf("Unable to get credentials: %v", err)
+	}
+	assert.Equal(t, "ak-1", credentials.AccessKey)
+	assert.Equal(t, "sk-1", credentials.SecretKey)
+	assert.Equal(t, "token-1", credentials.SecurityToken)
+
+	credentials, err = provider.GetCredentials(request)
+	assert.NoError(t, err)
+	assert.Equal(t, "ak-1", credentials.AccessKey, "Valid credentials must be served from the cache.")
+	assert.Equal(t, 1, calls)
+}
+
+// Tests, if credentials that are about to expire are refreshed.
+func TestMetadataCredentialProviderRefresh(t *testing.T) {
+	calls := 0
+	metadata := newFakeMetadataServer(t, metadataExpiryMargin/2, &calls)
+	defer metadata.Close()
+
+	provider := newMetadataCredentialProvider(metadata.URL)
+	request := &CredentialRequest{Config: &OtcDnsConfig{}, AllowAmbientCredentials: true}
+
+	_, err := provider.GetCredentials(request)
+	assert.NoError(t, err)
+	credentials, err := provider.GetCredentials(request)
+	assert.NoError(t, err)
+	assert.Equal(t, "ak-2", credentials.AccessKey, "Credentials within the expiry margin must be refreshed.")
+
+	_, err = provider.GetCredentials(&CredentialRequest{Config: &OtcDnsConfig{}, AllowAmbientCredentials: false})
+	assert.Error(t, err, "The agency of the node must not be used without permission for ambient credentials.")
+}
+
+// Tests, that concurrent requests fetch the temporary credentials once, and that the cached credentials are not locked while they are fetched.
+func TestMetadataCredentialProviderConcurrency(t *testing.T) {
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	var mutex sync.Mutex
+	calls := 0
+	metadata := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		calls++
+		mutex.Unlock()
+		select {
+		case started <- struct{}{}:
+		default:
+		}
+		<-release
+		expiresAt := time.Now().Add(time.Hour).UTC().Format("2006-01-02T15:04:05.000000Z")
+		_, _ = fmt.Fprintf(w, `{"credential": {"access": "ak", "secret": "sk", "securitytoken": "token", "expires_at": %q}}`, expiresAt)
+	}))
+	defer metadata.Close()
+
+	provider := newMetadataCredentialProvider(metadata.URL)
+	request := &CredentialRequest{Config: &OtcDnsConfig{}, AllowAmbientCredentials: true}
+
+	errs := make(chan error, 4)
+	for i := 0; i < cap(errs); i++ {
+		go func() {
+			_, err := provider.GetCredentials(request)
+			errs <- err
+		}()
+	}
+	<-started
+
+	done := make(chan struct{})
+	go func() {
+		assert.Nil(t, provider.getCached(), "No credentials are cached yet.")
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Error("The cache must not be locked, while the credentials are fetched.")
+	}
+
+	close(release)
+	for i := 0; i < cap(errs); i++ {
+		assert.NoError(t, <-errs)
+	}
+	assert.Equal(t, 1, calls, "Concurrent requests must fetch the credentials once.")
+}
@@ -0,0 +1,118 @@
+package otcdns
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	extapi "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/klog"
+)
+
+// ===========================================================================
+// Preflight check
+// ===========================================================================
+
+const (
+	// The prefix of the subdomain of the test recordset.
+	// The recordset is named _acme-challenge.otcdns-preflight-<pod>-<random>.<zone>.
+	preflightSubdomainPrefix string = "_acme-challenge.otcdns-preflight-"
+	// The longest pod name in the label of the test recordset. A DNS label has 63 characters at most.
+	maxPreflightPodNameLength int = 37
+)
+
+// Preflight checks the given solver configuration without a challenge.
+// It authenticates with the configured credentials and lists the zones.
+// When a preflightZone is configured, it also creates and deletes a test recordset in this zone.
+// A zone pinned with zoneID is used instead of looking the zone up by name.
+//
+// namespace: The resource namespace the secrets are loaded from, like for a challenge.
+// allowAmbientCredentials: Allows to fall back to the ambient credentials of the webhook.
+func (s *OtcDnsSolver) Preflight(cfgJSON *extapi.JSON, namespace string, allowAmbientCredentials bool) error {
+	config, err := configJsonToOtcDnsConfig(cfgJSON)
+	if err != nil {
+		return fmt.Errorf("preflight failed. Json not converted. %s", err)
+	}
+
+	otcDnsClient, err := s.getOtcDnsClientFromConfig(&config, namespace, allowAmbientCredentials)
+	if err != nil {
+		return fmt.Errorf("preflight failed. Cannot authenticate. %s", err)
+	}
+
+	ctx := s.context()
+
+	allZones, err := otcDnsClient.ListZonesWithContext(ctx)
+	if err != nil {
+		return fmt.Errorf("preflight failed. Cannot list zones. %s", err)
+	}
+	klog.V(4).Infof("preflight listed %d zones", len(allZones))
+
+	if config.PreflightZone == "" {
+		return nil
+	}
+
+	// Every run uses its own recordset. The checks of several webhook replicas do not interfere then.
+	runID, err := newPreflightRunID()
+	if err != nil {
+		return fmt.Errorf("preflight failed. %s", err)
+	}
+
+	// The test recordset is created like the recordset of a challenge in the preflight zone: in the pinned zone,
+	// with the description and with the tags of the namespace.
+	zoneName := strings.TrimSuffix(config.PreflightZone, ".") + "."
+	challengeRequest := &v1alpha1.ChallengeRequest{
+		ResourceNamespace:       namespace,
+		ResolvedZone:            zoneName,
+		ResolvedFQDN:            preflightSubdomainPrefix + getPreflightPodLabel(s.podName) + runID + "." + zoneName,
+		AllowAmbientCredentials: allowAmbientCredentials,
+		Config:                  cfgJSON,
+	}
+	if err := s.setChallengeRecordSetOptions(otcDnsClient, &config, challengeRequest); err != nil {
+		return fmt.Errorf("preflight failed. %s", err)
+	}
+	zone, err := s.getHostedZoneFromChallengeRequest(ctx, otcDnsClient, &config, challengeRequest)
+	if err != nil {
+		return fmt.Errorf("preflight failed. Cannot get zone %s. %s", config.PreflightZone, err)
+	}
+
+	testValue := s.getSafeTxtValue("preflight-" + runID)
+	recordset, err := otcDnsClient.NewTxtRecordSetWithContext(ctx, zone, testValue)
+	if err != nil {
+		return fmt.Errorf("preflight failed. Cannot create recordset in zone %s. %s", zone.Name, err)
+	}
+	// Only the value of this run is deleted.
+	if _, err := otcDnsClient.DeleteTxtRecordValueWithContext(ctx, zone, testValue, true); err != nil {
+		return fmt.Errorf("preflight failed. Cannot delete recordset %s in zone %s. %s", recordset.Name, zone.Name, err)
+	}
+
+	return nil
+}
+
+// Returns a random ID of a preflight run.
+func newPreflightRunID() (string, error) {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("cannot create the ID of the run. %s", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Returns the pod name as part of a DNS label, followed by a "-". Returns "", when the pod name is unknown.
+func getPreflightPodLabel(podName string) string {
+	label := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '-'
+	}, strings.ToLower(podName))
+	if len(label) > maxPreflightPodNameLength {
+		label = label[:maxPreflightPodNameLength]
+	}
+	label = strings.Trim(label, "-")
+	if label == "" {
+		return ""
+	}
+	return label + "-"
+}
@@ -0,0 +1,89 @@
+// The tests in this file test the preflight check of the solver configurations against a fake IAM and a fake DNS.
+package otcdns
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/opentelekomcloud/gophertelekomcloud/openstack/common/tags"
+	"github.com/stretchr/testify/assert"
+)
+
+// Tests, if the preflight check creates and deletes its own test recordset and leaves the test recordsets of other runs alone.
+func TestPreflightWithZone(t *testing.T) {
+	dns := newFakeDns(t, fakeZone{ID: "zone", Name: "example.com.", ZoneType: ZoneTypePublic})
+	otherRun := dns.addRecordSet(fakeRecordSet{ZoneID: "zone", Name: "_acme-challenge.otcdns-preflight-webhook-1-00000000.example.com.", Records: []string{`"preflight-00000000"`}})
+	iam := newFakeIam(t, dns)
+
+	solver := NewSolver().(*OtcDnsSolver)
+	solver.podName = "webhook-0"
+	solver.statusWait = testStatusWaitPolicy
+	err := solver.Preflight(iam.solverConfig(t, map[string]interface{}{"preflightZone": "example.com."}), "cert-manager", true)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	created := dns.getRequests("POST /zones/zone/recordsets")
+	assert.Len(t, created, 1)
+	for _, lookup := range dns.getRequests("GET /zones/zone/recordsets") {
+		assert.True(t, strings.HasPrefix(lookup.Query.Get("name"), "_acme-challenge.otcdns-preflight-webhook-0-"), "The recordset must be named after the pod: %s", lookup.Query.Get("name"))
+	}
+	assert.Equal(t, []fakeRecordSet{*otherRun}, dns.getRecordSets(), "Only the test recordset of this run must be deleted.")
+	deleted := dns.getRequests("DELETE /zones/zone/recordsets/recordset-2")
+	assert.Len(t, deleted, 1)
+
+	// A second run uses another recordset.
+	err = solver.Preflight(iam.solverConfig(t, map[string]interface{}{"preflightZone": "example.com."}), "cert-manager", true)
+	assert.NoError(t, err)
+	assert.Len(t, dns.getRequests("DELETE /zones/zone/recordsets/recordset-3"), 1)
+}
+
+// Tests, if the preflight check creates its test recordset in the zone pinned by zoneID, and with the tags of the namespace.
+func TestPreflightWithPinnedZone(t *testing.T) {
+	dns := newFakeDns(t,
+		fakeZone{ID: "zone-other", Name: "example.com.", ZoneType: ZoneTypePublic},
+		fakeZone{ID: "zone-pinned", Name: "example.com.", ZoneType: ZoneTypePublic, ProjectID: "project-id"},
+	)
+	iam := newFakeIam(t, dns)
+
+	solver := NewSolver().(*OtcDnsSolver)
+	solver.statusWait = testStatusWaitPolicy
+	err := solver.Preflight(iam.solverConfig(t, map[string]interface{}{"preflightZone": "example.com.", "zoneID": "zone-pinned"}), "cert-manager", true)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Empty(t, dns.getRequests("POST /zones/zone-other/recordsets"))
+	created := dns.getRequests("POST /zones/zone-pinned/recordsets")
+	if assert.Len(t, created, 1) {
+		var body struct {
+			Tags []tags.ResourceTag `json:"tags"`
+		}
+		assert.NoError(t, json.Unmarshal(created[0].Body, &body))
+		assert.Contains(t, body.Tags, tags.ResourceTag{Key: TagKeyNamespace, Value: "cert-manager"})
+		assert.Contains(t, body.Tags, tags.ResourceTag{Key: TagKeyManagedBy, Value: TagValueManagedBy})
+	}
+	assert.Empty(t, dns.getRecordSets())
+}
+
+// Tests, if the preflight check only lists the zones, when no preflightZone is configured.
+func TestPreflightWithoutZone(t *testing.T) {
+	dns := newFakeDns(t)
+	iam := newFakeIam(t, dns)
+
+	solver := NewSolver().(*OtcDnsSolver)
+	err := solver.Preflight(iam.solverConfig(t, nil), "cert-manager", true)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, dns.getRequests("GET /zones"), "The zones must be listed.")
+	assert.Empty(t, dns.getRequests("POST /zones/zone/recordsets"), "No recordset must be created.")
+	assert.Empty(t, dns.getRecordSets())
+}
+
+// Tests, if the pod name is turned into a part of a DNS label.
+func TestGetPreflightPodLabel(t *testing.T) {
+	assert.Equal(t, "webhook-7d9f-abcde-", getPreflightPodLabel("Webhook-7d9f-abcde"))
+	assert.Equal(t, "", getPreflightPodLabel(""))
+	assert.Equal(t, "a-b-", getPreflightPodLabel("a.b"))
+	assert.Len(t, getPreflightPodLabel(strings.Repeat("a", 100)), maxPreflightPodNameLength+1)
+}
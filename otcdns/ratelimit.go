@@ -0,0 +1,155 @@
+package otcdns
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	otc "github.com/opentelekomcloud/gophertelekomcloud"
+	otcos "github.com/opentelekomcloud/gophertelekomcloud/openstack"
+	"github.com/opentelekomcloud/gophertelekomcloud/openstack/identity/v3/domains"
+	"golang.org/x/time/rate"
+	"k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+	"k8s.io/klog"
+)
+
+// ===========================================================================
+// Rate limits
+// ===========================================================================
+
+var (
+	// The time the requests to the DNS API waited for the rate limiter of their account.
+	dnsRateLimitWait = metrics.NewHistogramVec(&metrics.HistogramOpts{
+		Namespace:      "otcdns",
+		Name:           "api_rate_limit_wait_seconds",
+		Help:           "Time the requests to the OTC DNS API waited for the client-side rate limiter of their account.",
+		Buckets:        []float64{0.001, 0.01, 0.05, 0.1, 0.5, 1, 2.5, 5, 10, 30},
+		StabilityLevel: metrics.ALPHA,
+	}, []string{"account"})
+
+	registerRateLimitMetrics sync.Once
+)
+
+// RateLimiter delays the requests to the DNS API. Wait blocks until the next request may be sent.
+type RateLimiter interface {
+	Wait(ctx context.Context) error
+}
+
+// The token buckets of the OTC accounts. All clients of an account share one bucket,
+// so that the challenges of many certificates together stay within the quotas of the DNS API.
+type accountRateLimiters struct {
+	// The sustained requests per second and the burst of each account. A rate of 0 disables the limits.
+	qps   float64
+	burst int
+
+	mutex    sync.Mutex
+	limiters map[string]*accountRateLimiter
+}
+
+// The token bucket of one account. The time waited is recorded in otcdns_api_rate_limit_wait_seconds.
+type accountRateLimiter struct {
+	account string
+	limiter *rate.Limiter
+}
+
+func newAccountRateLimiters(qps float64, burst int) *accountRateLimiters {
+	registerRateLimitMetrics.Do(func() {
+		legacyregistry.MustRegister(dnsRateLimitWait)
+	})
+
+	return &accountRateLimiters{
+		qps:      qps,
+		burst:    burst,
+		limiters: map[string]*accountRateLimiter{},
+	}
+}
+
+// Returns the rate limiter of the given account. Returns nil, when the limits are disabled.
+func (l *accountRateLimiters) Get(account string) RateLimiter {
+	if l == nil || l.qps <= 0 {
+		return nil
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	limiter, ok := l.limiters[account]
+	if !ok {
+		burst := l.burst
+		if burst < 1 {
+			burst = 1
+		}
+		limiter = &accountRateLimiter{account: account, limiter: rate.NewLimiter(rate.Limit(l.qps), burst)}
+		l.limiters[account] = limiter
+	}
+	return limiter
+}
+
+func (l *accountRateLimiter) Wait(ctx context.Context) error {
+	start := time.Now()
+	err := l.limiter.Wait(ctx)
+	dnsRateLimitWait.WithLabelValues(l.account).Observe(time.Since(start).Seconds())
+	return err
+}
+
+// Returns the account the rate limit of the client applies to.
+func (dnsClient *OtcDnsClient) accountKey() string {
+	if dnsClient.AccountID != "" {
+		return dnsClient.AccountID
+	}
+	return dnsClient.ProjectID
+}
+
+// Identifies the account of an authenticated provider client. This is the IAM domain of the client.
+// The token of a password or token authentication names the domain. The AK/SK authentication only knows the domain,
+// when the domain or an agency was configured. Otherwise the domain of the access key is listed at the IAM.
+// The account falls back to a fingerprint of the identity endpoint and the access key, when the IAM does not list it.
+func getAccountID(providerClient *otc.ProviderClient) string {
+	akskAuthOpts := providerClient.AKSKAuthOptions
+	switch {
+	case akskAuthOpts.AgencyDomainName != "":
+		// The requests are made with the agency of the delegating domain.
+		return "domain-name:" + akskAuthOpts.AgencyDomainName
+	case providerClient.DomainID != "":
+		return providerClient.DomainID
+	case akskAuthOpts.DomainID != "":
+		return akskAuthOpts.DomainID
+	case akskAuthOpts.AccessKey == "":
+		return ""
+	}
+
+	domainID, err := getAccessKeyDomainID(providerClient)
+	if err == nil {
+		return domainID
+	}
+	klog.Warningf("cannot determine the domain of the access key. The rate limits apply to the access key. %s", err)
+	fingerprint := sha256.Sum256([]byte(providerClient.IdentityEndpoint + "\n" + akskAuthOpts.AccessKey))
+	return "access-key:" + hex.EncodeToString(fingerprint[:8])
+}
+
+// Lists the domain the access key of the provider client belongs to.
+func getAccessKeyDomainID(providerClient *otc.ProviderClient) (string, error) {
+	identityClient, err := otcos.NewIdentityV3(providerClient, otc.EndpointOpts{})
+	if err != nil {
+		return "", err
+	}
+	// The domains accessible with the credentials are listed below "auth/".
+	identityClient.Endpoint += "auth/"
+
+	allPages, err := domains.List(identityClient, nil).AllPages()
+	if err != nil {
+		return "", fmt.Errorf("list domains failed. %s", err)
+	}
+	allDomains, err := domains.ExtractDomains(allPages)
+	if err != nil {
+		return "", fmt.Errorf("extract domains failed. %s", err)
+	}
+	if len(allDomains) != 1 {
+		return "", fmt.Errorf("the access key can access %d domains", len(allDomains))
+	}
+	return allDomains[0].ID, nil
+}
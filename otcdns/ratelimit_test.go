@@ -0,0 +1,88 @@
+// The tests in this file test the client-side rate limits.
+package otcdns
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/component-base/metrics/testutil"
+)
+
+// Tests, if the clients of an account share one rate limiter.
+func TestAccountRateLimitersAreShared(t *testing.T) {
+	rateLimiters := newAccountRateLimiters(10, 1)
+
+	assert.Same(t, rateLimiters.Get("domain-a"), rateLimiters.Get("domain-a"))
+	assert.NotSame(t, rateLimiters.Get("domain-a"), rateLimiters.Get("domain-b"))
+	assert.Nil(t, newAccountRateLimiters(0, 1).Get("domain-a"), "a rate of 0 disables the limits")
+}
+
+// Tests, if the requests of an account are delayed and the time waited is recorded.
+func TestRateLimitDelaysRequests(t *testing.T) {
+	dns := newFakeDns(t, fakeZone{ID: "zone", Name: "example.com."})
+
+	rateLimiters := newAccountRateLimiters(10, 1)
+	limiter := rateLimiters.Get("rate-limited-domain")
+	countBefore, err := testutil.GetHistogramMetricCount(dnsRateLimitWait.WithLabelValues("rate-limited-domain"))
+	assert.NoError(t, err)
+
+	// Two clients of the same account.
+	otcDnsClient1 := dns.client()
+	otcDnsClient1.RateLimiter = limiter
+	otcDnsClient2 := dns.client()
+	otcDnsClient2.RateLimiter = limiter
+
+	start := time.Now()
+	for _, otcDnsClient := range []*OtcDnsClient{otcDnsClient1, otcDnsClient2, otcDnsClient1} {
+		_, err := otcDnsClient.GetHostedZoneByIDWithContext(context.Background(), "zone")
+		assert.NoError(t, err)
+	}
+	// The burst allows the first request. The others wait for 100ms each.
+	assert.GreaterOrEqual(t, time.Since(start), 150*time.Millisecond)
+
+	countAfter, err := testutil.GetHistogramMetricCount(dnsRateLimitWait.WithLabelValues("rate-limited-domain"))
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(3), countAfter-countBefore)
+}
+
+// Tests, if a request gives up waiting, when its context is cancelled.
+func TestRateLimitHonoursContext(t *testing.T) {
+	limiter := newAccountRateLimiters(0.001, 1).Get("slow-domain")
+	assert.NoError(t, limiter.Wait(context.Background()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.Error(t, limiter.Wait(ctx))
+}
+
+// Tests, that the clients of two projects of one account share the rate limiter of the account,
+// and that the clients of another account get their own rate limiter.
+func TestAccountRateLimitersAreSharedByProjects(t *testing.T) {
+	iam := newFakeIam(t, nil)
+	solver := newSolverWithSecrets(t)
+	solver.rateLimiters = newAccountRateLimiters(10, 1)
+	getClient := func(accessKey string, projectID string) *OtcDnsClient {
+		config := &OtcDnsConfig{
+			AuthURL:   iam.authURL(),
+			Region:    "eu-de",
+			ProjectID: projectID,
+			AccessKey: accessKey,
+			SecretKey: "sk",
+		}
+		otcDnsClient, err := solver.getOtcDnsClientFromConfig(config, "team-a", false)
+		if err != nil {
+			t.Fatalf("Unable to create client: %v", err)
+		}
+		return otcDnsClient
+	}
+
+	clientA := getClient("ak-a", "project-a")
+	clientB := getClient("ak-a", "project-b")
+	clientC := getClient("ak-c", "project-c")
+
+	assert.Equal(t, "domain-of-ak-a", clientA.AccountID)
+	assert.Same(t, clientA.RateLimiter, clientB.RateLimiter)
+	assert.NotSame(t, clientA.RateLimiter, clientC.RateLimiter)
+}
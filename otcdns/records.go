@@ -0,0 +1,72 @@
+package otcdns
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+)
+
+// ===========================================================================
+// TTL and description of the challenge recordsets
+// ===========================================================================
+
+const (
+	// The TTL of the challenge recordsets, when the issuer configures none.
+	defaultRecordSetTTL int = 300
+	// The range of the TTL the OTC DNS accepts.
+	minRecordSetTTL int = 1
+	maxRecordSetTTL int = 2147483647
+	// The OTC DNS rejects longer descriptions.
+	maxRecordSetDescriptionLength int = 255
+)
+
+// The values the description template of the challenge recordsets can use,
+// e.g. "ACME Challenge of {{ .Namespace }} in {{ .ClusterName }} for {{ .FQDN }}".
+type recordSetDescriptionData struct {
+	// The resource namespace of the challenge.
+	Namespace string
+	// The name of the cluster the webhook runs in (CLUSTER_NAME).
+	ClusterName string
+	// The FQDN of the challenge recordset.
+	FQDN string
+}
+
+// Returns the TTL of the challenge recordsets of the issuer.
+// Fails, when the TTL is outside of the range the OTC DNS accepts.
+func (cfg *OtcDnsConfig) getRecordSetTTL() (int, error) {
+	if cfg.TTL == 0 {
+		return defaultRecordSetTTL, nil
+	}
+	if cfg.TTL < minRecordSetTTL || cfg.TTL > maxRecordSetTTL {
+		return 0, fmt.Errorf("invalid ttl %d. The OTC DNS accepts %d to %d seconds", cfg.TTL, minRecordSetTTL, maxRecordSetTTL)
+	}
+	return cfg.TTL, nil
+}
+
+// Renders the description of the challenge recordset from the template of the issuer.
+// Returns the default description, when the issuer configures no template.
+func (s *OtcDnsSolver) getRecordSetDescription(config *OtcDnsConfig, challengeRequest *v1alpha1.ChallengeRequest) (string, error) {
+	if config.DescriptionTemplate == "" {
+		return dnsRecordDescription, nil
+	}
+
+	descriptionTemplate, err := template.New("description").Option("missingkey=error").Parse(config.DescriptionTemplate)
+	if err != nil {
+		return "", fmt.Errorf("invalid descriptionTemplate: %s", err)
+	}
+	var description strings.Builder
+	err = descriptionTemplate.Execute(&description, recordSetDescriptionData{
+		Namespace:   challengeRequest.ResourceNamespace,
+		ClusterName: s.clusterName,
+		FQDN:        challengeRequest.ResolvedFQDN,
+	})
+	if err != nil {
+		return "", fmt.Errorf("invalid descriptionTemplate: %s", err)
+	}
+	if description.Len() > maxRecordSetDescriptionLength {
+		return "", fmt.Errorf("the description rendered from the descriptionTemplate has %d characters. The OTC DNS accepts %d", description.Len(), maxRecordSetDescriptionLength)
+	}
+	return description.String(), nil
+}
@@ -0,0 +1,61 @@
+// The tests in this file test the TTL and the description of the challenge recordsets.
+package otcdns
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	"github.com/opentelekomcloud/gophertelekomcloud/openstack/dns/v2/zones"
+	"github.com/stretchr/testify/assert"
+)
+
+// Tests, if the TTL must be in the range the OTC DNS accepts.
+func TestGetRecordSetTTL(t *testing.T) {
+	ttl, err := (&OtcDnsConfig{}).getRecordSetTTL()
+	assert.NoError(t, err)
+	assert.Equal(t, defaultRecordSetTTL, ttl)
+
+	ttl, err = (&OtcDnsConfig{TTL: 60}).getRecordSetTTL()
+	assert.NoError(t, err)
+	assert.Equal(t, 60, ttl)
+
+	_, err = (&OtcDnsConfig{TTL: -1}).getRecordSetTTL()
+	assert.ErrorContains(t, err, "invalid ttl")
+}
+
+// Tests, if the description is rendered from the template of the issuer.
+func TestGetRecordSetDescription(t *testing.T) {
+	solver := &OtcDnsSolver{clusterName: "prod"}
+	challengeRequest := &v1alpha1.ChallengeRequest{ResourceNamespace: "team-a", ResolvedFQDN: "_acme-challenge.example.com."}
+
+	description, err := solver.getRecordSetDescription(&OtcDnsConfig{}, challengeRequest)
+	assert.NoError(t, err)
+	assert.Equal(t, "ACME Challenge", description)
+
+	description, err = solver.getRecordSetDescription(&OtcDnsConfig{DescriptionTemplate: "ACME Challenge of {{ .Namespace }} in {{ .ClusterName }} for {{ .FQDN }}"}, challengeRequest)
+	assert.NoError(t, err)
+	assert.Equal(t, "ACME Challenge of team-a in prod for _acme-challenge.example.com.", description)
+
+	_, err = solver.getRecordSetDescription(&OtcDnsConfig{DescriptionTemplate: "{{ .Unknown }}"}, challengeRequest)
+	assert.ErrorContains(t, err, "invalid descriptionTemplate")
+
+	_, err = solver.getRecordSetDescription(&OtcDnsConfig{DescriptionTemplate: strings.Repeat("x", maxRecordSetDescriptionLength+1)}, challengeRequest)
+	assert.Error(t, err)
+}
+
+// Tests, if the recordset is created with the TTL and the description of the client.
+func TestNewTxtRecordSetWithTTLAndDescription(t *testing.T) {
+	dns := newFakeDns(t)
+
+	otcDnsClient := dns.client()
+	otcDnsClient.TTL = 60
+	otcDnsClient.Description = "ACME Challenge of team-a"
+
+	_, err := otcDnsClient.NewTxtRecordSetWithContext(context.Background(), &zones.Zone{ID: "zone", Name: "example.com."}, `"value"`)
+	assert.NoError(t, err)
+	recordSet := dns.getRecordSets()[0]
+	assert.Equal(t, 60, recordSet.TTL)
+	assert.Equal(t, "ACME Challenge of team-a", recordSet.Description)
+}
@@ -0,0 +1,247 @@
+package otcdns
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	otc "github.com/opentelekomcloud/gophertelekomcloud"
+	"github.com/opentelekomcloud/gophertelekomcloud/openstack/common/tags"
+	"github.com/opentelekomcloud/gophertelekomcloud/openstack/dns/v2/recordsets"
+	"github.com/opentelekomcloud/gophertelekomcloud/openstack/dns/v2/zones"
+	"github.com/opentelekomcloud/gophertelekomcloud/pagination"
+)
+
+// ===========================================================================
+// Tags of the challenge recordsets
+// ===========================================================================
+
+// The tags the webhook adds to the recordsets it creates. They attribute a challenge recordset
+// to the cluster and the namespace of its challenge, when several clusters share one zone.
+const (
+	TagKeyClusterID string = "cluster-id"
+	TagKeyNamespace string = "namespace"
+	TagKeyManagedBy string = "managed-by"
+	// The value of the managed-by tag.
+	TagValueManagedBy string = "infra-otc-cert-manager-webhook"
+	// The value of the namespace tag of a recordset, that holds the challenge values of several namespaces.
+	TagValueSharedNamespace string = "shared"
+
+	// The OTC DNS rejects longer tag values.
+	maxTagValueLength int = 43
+)
+
+// Returns the tags of the challenge recordsets of the given cluster and namespace.
+// The tag of an empty cluster ID is left out.
+func getRecordSetTags(clusterID string, namespace string) map[string]string {
+	recordSetTags := map[string]string{
+		TagKeyManagedBy: TagValueManagedBy,
+		TagKeyNamespace: sanitizeTagValue(namespace),
+	}
+	if clusterID != "" {
+		recordSetTags[TagKeyClusterID] = sanitizeTagValue(clusterID)
+	}
+	return recordSetTags
+}
+
+// Replaces the characters the OTC DNS does not accept in tag values with "-" and cuts the value to its maximum length.
+func sanitizeTagValue(value string) string {
+	value = strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.' {
+			return r
+		}
+		return '-'
+	}, value)
+	if len(value) > maxTagValueLength {
+		value = value[:maxTagValueLength]
+	}
+	return value
+}
+
+// The create request of a recordset with tags. The recordsets package of the SDK does not support tags.
+type taggedRecordSetCreateOpts struct {
+	recordsets.CreateOpts
+	Tags map[string]string
+}
+
+func (opts taggedRecordSetCreateOpts) ToRecordSetCreateMap() (map[string]interface{}, error) {
+	b, err := opts.CreateOpts.ToRecordSetCreateMap()
+	if err != nil {
+		return nil, err
+	}
+	resourceTags := make([]tags.ResourceTag, 0, len(opts.Tags))
+	for _, key := range sortedTagKeys(opts.Tags) {
+		resourceTags = append(resourceTags, tags.ResourceTag{Key: key, Value: opts.Tags[key]})
+	}
+	b["tags"] = resourceTags
+	return b, nil
+}
+
+// The list request of recordsets with tags. The recordsets package of the SDK does not support the tags filter.
+type taggedRecordSetListOpts struct {
+	recordsets.ListOpts
+	Tags map[string]string
+}
+
+// The tags filter has the format "key1,value1|key2,value2". A recordset must have all tags.
+func (opts taggedRecordSetListOpts) ToRecordSetListQuery() (string, error) {
+	q, err := otc.BuildQueryString(opts.ListOpts)
+	if err != nil {
+		return "", err
+	}
+	query := q.Query()
+	filters := make([]string, 0, len(opts.Tags))
+	for _, key := range sortedTagKeys(opts.Tags) {
+		filters = append(filters, key+","+opts.Tags[key])
+	}
+	if len(filters) > 0 {
+		query.Set("tags", strings.Join(filters, "|"))
+	}
+	q.RawQuery = query.Encode()
+	return q.String(), nil
+}
+
+func sortedTagKeys(recordSetTags map[string]string) []string {
+	keys := make([]string, 0, len(recordSetTags))
+	for key := range recordSetTags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Lists the TXT recordsets in all zones of the client, that have all the given tags, e.g. the challenge recordsets of a cluster:
+// map[string]string{TagKeyClusterID: "prod", TagKeyManagedBy: TagValueManagedBy}
+func (dnsClient *OtcDnsClient) ListRecordSetsByTags(recordSetTags map[string]string) ([]recordsets.RecordSet, error) {
+	return dnsClient.ListRecordSetsByTagsWithContext(context.Background(), recordSetTags)
+}
+
+// Lists the TXT recordsets in all zones of the client, that have all the given tags.
+// The request is cancelled with the context or after the read timeout.
+func (dnsClient *OtcDnsClient) ListRecordSetsByTagsWithContext(ctx context.Context, recordSetTags map[string]string) ([]recordsets.RecordSet, error) {
+	return dnsClient.listRecordSetsByTags(ctx, nil, recordSetTags)
+}
+
+// Lists the TXT recordsets in the given zone, that have all the given tags.
+func (dnsClient *OtcDnsClient) ListZoneRecordSetsByTags(zone *zones.Zone, recordSetTags map[string]string) ([]recordsets.RecordSet, error) {
+	return dnsClient.ListZoneRecordSetsByTagsWithContext(context.Background(), zone, recordSetTags)
+}
+
+// Lists the TXT recordsets in the given zone, that have all the given tags.
+// The request is cancelled with the context or after the read timeout.
+func (dnsClient *OtcDnsClient) ListZoneRecordSetsByTagsWithContext(ctx context.Context, zone *zones.Zone, recordSetTags map[string]string) ([]recordsets.RecordSet, error) {
+	return dnsClient.listRecordSetsByTags(ctx, zone, recordSetTags)
+}
+
+// Lists the TXT recordsets with the given tags in the given zone, or in all zones, when the zone is nil.
+func (dnsClient *OtcDnsClient) listRecordSetsByTags(ctx context.Context, zone *zones.Zone, recordSetTags map[string]string) ([]recordsets.RecordSet, error) {
+	if len(recordSetTags) == 0 {
+		return nil, fmt.Errorf("list recordsets by tags failed. At least one tag is required")
+	}
+	listOpts := taggedRecordSetListOpts{
+		ListOpts: recordsets.ListOpts{Type: dnsRecordTypeTxt},
+		Tags:     recordSetTags,
+	}
+
+	var allPages pagination.Page
+	err := dnsClient.withRetries(ctx, "list recordsets by tags", dnsClient.Timeouts.Read, func(sc *otc.ServiceClient, retry int) error {
+		var err error
+		if zone != nil {
+			allPages, err = recordsets.ListByZone(sc, zone.ID, listOpts).AllPages()
+		} else {
+			allPages, err = listAllRecordSets(sc, listOpts).AllPages()
+		}
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list recordsets by tags failed: %s", err)
+	}
+
+	allRRs, err := recordsets.ExtractRecordSets(allPages)
+	if err != nil {
+		return nil, fmt.Errorf("extract recordsets failed: %s", err)
+	}
+	return allRRs, nil
+}
+
+// Lists the recordsets of all zones. The recordsets package of the SDK only lists the recordsets of a zone.
+func listAllRecordSets(sc *otc.ServiceClient, opts recordsets.ListOptsBuilder) pagination.Pager {
+	url := sc.ServiceURL("recordsets")
+	query, err := opts.ToRecordSetListQuery()
+	if err != nil {
+		return pagination.Pager{Err: err}
+	}
+	return pagination.NewPager(sc, url+query, func(r pagination.PageResult) pagination.Page {
+		return recordsets.RecordSetPage{LinkedPageBase: pagination.LinkedPageBase{PageResult: r}}
+	})
+}
+
+// Marks a recordset as shared, when a challenge of another namespace added its value to it.
+// The namespace tag of the recordset is replaced with "shared", so the recordset is not attributed to the namespace,
+// that created it, alone. Recordsets, that the webhook did not create, and clients without tags are left alone.
+func (dnsClient *OtcDnsClient) TagSharedRecordSetWithContext(ctx context.Context, zone *zones.Zone, recordSet *recordsets.RecordSet) error {
+	namespace := dnsClient.Tags[TagKeyNamespace]
+	if namespace == "" {
+		return nil
+	}
+	resourceType := getRecordSetTagResourceType(zone)
+	projectID, err := dnsClient.getTagProjectID(zone)
+	if err != nil {
+		return err
+	}
+
+	var recordSetTags []tags.ResourceTag
+	err = dnsClient.withRetries(ctx, "get tags of recordset "+recordSet.ID, dnsClient.Timeouts.Read, func(sc *otc.ServiceClient, retry int) error {
+		var err error
+		sc.ProjectID = projectID
+		recordSetTags, err = tags.Get(sc, resourceType, recordSet.ID).Extract()
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("get tags failed for recordset ID %s: %s", recordSet.ID, err)
+	}
+
+	tagValues := map[string]string{}
+	for _, tag := range recordSetTags {
+		tagValues[tag.Key] = tag.Value
+	}
+	if tagValues[TagKeyManagedBy] != TagValueManagedBy {
+		return nil
+	}
+	if tagValues[TagKeyNamespace] == namespace || tagValues[TagKeyNamespace] == TagValueSharedNamespace {
+		return nil
+	}
+
+	// A created tag replaces the value of an existing tag. Sending it again has the same result.
+	sharedTags := []tags.ResourceTag{{Key: TagKeyNamespace, Value: TagValueSharedNamespace}}
+	err = dnsClient.withRetries(ctx, "tag recordset "+recordSet.ID, dnsClient.Timeouts.Update, func(sc *otc.ServiceClient, retry int) error {
+		sc.ProjectID = projectID
+		return tags.Create(sc, resourceType, recordSet.ID, sharedTags).ExtractErr()
+	})
+	if err != nil {
+		return fmt.Errorf("tag recordset failed for recordset ID %s: %s", recordSet.ID, err)
+	}
+	return nil
+}
+
+// Returns the project the tags API is addressed with for the recordsets of the given zone. This is the project of the zone.
+// The project of the client applies, when the API did not return the project of the zone.
+// A client, that is scoped to the domain, has no project of its own.
+func (dnsClient *OtcDnsClient) getTagProjectID(zone *zones.Zone) (string, error) {
+	if zone.ProjectID != "" {
+		return zone.ProjectID, nil
+	}
+	if dnsClient.Sc.ProjectID != "" {
+		return dnsClient.Sc.ProjectID, nil
+	}
+	return "", fmt.Errorf("the tags of the recordsets of zone %s cannot be addressed. The project of the zone is unknown", zone.Name)
+}
+
+// Returns the resource type of the tags API for the recordsets of the given zone.
+func getRecordSetTagResourceType(zone *zones.Zone) string {
+	if zone.ZoneType == ZoneTypePrivate {
+		return "DNS-private_recordset"
+	}
+	return "DNS-public_recordset"
+}
@@ -0,0 +1,175 @@
+// The tests in this file test the tags of the challenge recordsets.
+package otcdns
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	"github.com/opentelekomcloud/gophertelekomcloud/openstack/dns/v2/recordsets"
+	"github.com/opentelekomcloud/gophertelekomcloud/openstack/dns/v2/zones"
+	"github.com/stretchr/testify/assert"
+)
+
+// Tests, if the tags identify the cluster, the namespace and the webhook.
+func TestGetRecordSetTags(t *testing.T) {
+	assert.Equal(t, map[string]string{
+		TagKeyClusterID: "prod-eu_de.1",
+		TagKeyNamespace: "team-a",
+		TagKeyManagedBy: TagValueManagedBy,
+	}, getRecordSetTags("prod/eu_de.1", "team-a"))
+
+	assert.NotContains(t, getRecordSetTags("", "team-a"), TagKeyClusterID)
+	assert.Len(t, sanitizeTagValue(strings.Repeat("a", 63)), maxTagValueLength)
+}
+
+// Tests, if a recordset is created with the tags of the client.
+func TestNewTxtRecordSetWithTags(t *testing.T) {
+	dns := newFakeDns(t)
+
+	otcDnsClient := dns.client()
+	otcDnsClient.Tags = getRecordSetTags("prod", "team-a")
+
+	_, err := otcDnsClient.NewTxtRecordSetWithContext(context.Background(), &zones.Zone{ID: "zone", Name: "example.com."}, `"value"`)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		TagKeyClusterID: "prod",
+		TagKeyManagedBy: TagValueManagedBy,
+		TagKeyNamespace: "team-a",
+	}, dns.getRecordSets()[0].Tags)
+}
+
+// Tests, if the recordsets are queried by their tags in a zone and in all zones.
+func TestListRecordSetsByTags(t *testing.T) {
+	dns := newFakeDns(t)
+	prodTags := getRecordSetTags("prod", "team-a")
+	dns.addRecordSet(fakeRecordSet{ZoneID: "zone", Name: "_acme-challenge.example.com.", Tags: prodTags})
+	dns.addRecordSet(fakeRecordSet{ZoneID: "other", Name: "_acme-challenge.example.org.", Tags: prodTags})
+	dns.addRecordSet(fakeRecordSet{ZoneID: "zone", Name: "_acme-challenge.www.example.com.", Tags: getRecordSetTags("dev", "team-a")})
+	otcDnsClient := dns.client()
+	clusterTags := map[string]string{TagKeyClusterID: "prod", TagKeyManagedBy: TagValueManagedBy}
+
+	allRRs, err := otcDnsClient.ListRecordSetsByTags(clusterTags)
+	if assert.NoError(t, err) {
+		assert.Len(t, allRRs, 2)
+	}
+	for _, request := range dns.getRequests("GET /recordsets") {
+		assert.Equal(t, "cluster-id,prod|managed-by,"+TagValueManagedBy, request.Query.Get("tags"))
+		assert.Equal(t, dnsRecordTypeTxt, request.Query.Get("type"))
+	}
+
+	allRRs, err = otcDnsClient.ListZoneRecordSetsByTags(&zones.Zone{ID: "zone"}, clusterTags)
+	if assert.NoError(t, err) && assert.Len(t, allRRs, 1) {
+		assert.Equal(t, "_acme-challenge.example.com.", allRRs[0].Name)
+	}
+
+	_, err = otcDnsClient.ListRecordSetsByTags(nil)
+	assert.Error(t, err)
+}
+
+// Tests, if a recordset of another namespace is marked as shared, and if the recordsets of the own namespace,
+// shared recordsets and recordsets, that the webhook did not create, keep their tags.
+func TestTagSharedRecordSet(t *testing.T) {
+	dns := newFakeDns(t)
+	zone := &zones.Zone{ID: "zone", Name: "example.com.", ZoneType: ZoneTypePrivate}
+	teamA := dns.addRecordSet(fakeRecordSet{ZoneID: "zone", Name: "_acme-challenge.a.example.com.", Tags: getRecordSetTags("prod", "team-a")})
+	teamB := dns.addRecordSet(fakeRecordSet{ZoneID: "zone", Name: "_acme-challenge.b.example.com.", Tags: getRecordSetTags("prod", "team-b")})
+	unmanaged := dns.addRecordSet(fakeRecordSet{ZoneID: "zone", Name: "_acme-challenge.c.example.com.", Tags: map[string]string{TagKeyNamespace: "team-a"}})
+	otcDnsClient := dns.client()
+	// The tags API is addressed with the project of the token.
+	otcDnsClient.Sc.ProjectID = "project-id"
+	otcDnsClient.Tags = getRecordSetTags("prod", "team-b")
+
+	for _, recordSet := range []*fakeRecordSet{teamA, teamB, unmanaged} {
+		assert.NoError(t, otcDnsClient.TagSharedRecordSetWithContext(context.Background(), zone, &recordsets.RecordSet{ID: recordSet.ID}))
+	}
+
+	tagsByID := map[string]map[string]string{}
+	for _, recordSet := range dns.getRecordSets() {
+		tagsByID[recordSet.ID] = recordSet.Tags
+	}
+	assert.Equal(t, map[string]string{
+		TagKeyClusterID: "prod",
+		TagKeyManagedBy: TagValueManagedBy,
+		TagKeyNamespace: TagValueSharedNamespace,
+	}, tagsByID[teamA.ID])
+	assert.Equal(t, getRecordSetTags("prod", "team-b"), tagsByID[teamB.ID])
+	assert.Equal(t, map[string]string{TagKeyNamespace: "team-a"}, tagsByID[unmanaged.ID])
+
+	// The shared recordset is not tagged again.
+	assert.NoError(t, otcDnsClient.TagSharedRecordSetWithContext(context.Background(), zone, &recordsets.RecordSet{ID: teamA.ID}))
+	actions := 0
+	for _, recordSet := range []*fakeRecordSet{teamA, teamB, unmanaged} {
+		actions += len(dns.getRequests("POST /project-id/DNS-private_recordset/" + recordSet.ID + "/tags/action"))
+	}
+	assert.Equal(t, 1, actions)
+}
+
+// Tests, that a client, that is scoped to the domain, addresses the tags with the project of the zone,
+// and that it fails, when the project of the zone is unknown.
+func TestTagSharedRecordSetWithDomainScopedClient(t *testing.T) {
+	dns := newFakeDns(t)
+	recordSet := dns.addRecordSet(fakeRecordSet{ZoneID: "zone", Name: "_acme-challenge.example.com.", Tags: getRecordSetTags("prod", "team-a")})
+	otcDnsClient := dns.client()
+	otcDnsClient.Tags = getRecordSetTags("prod", "team-b")
+
+	zone := &zones.Zone{ID: "zone", Name: "example.com.", ZoneType: ZoneTypePublic}
+	assert.Error(t, otcDnsClient.TagSharedRecordSetWithContext(context.Background(), zone, &recordsets.RecordSet{ID: recordSet.ID}))
+
+	zone.ProjectID = "project-a"
+	assert.NoError(t, otcDnsClient.TagSharedRecordSetWithContext(context.Background(), zone, &recordsets.RecordSet{ID: recordSet.ID}))
+	assert.Len(t, dns.getRequests("POST /project-a/DNS-public_recordset/"+recordSet.ID+"/tags/action"), 1)
+	assert.Equal(t, TagValueSharedNamespace, dns.getRecordSets()[0].Tags[TagKeyNamespace])
+}
+
+// Tests, if a challenge, that adds its value to the recordset of another namespace, marks the recordset as shared.
+func TestPresentTagsSharedRecordSet(t *testing.T) {
+	dns := newFakeDns(t, fakeZone{ID: "zone", Name: "example.com.", ZoneType: ZoneTypePublic})
+	recordSet := dns.addRecordSet(fakeRecordSet{ZoneID: "zone", Name: "_acme-challenge.example.com.", Records: []string{`"key-a"`}, Tags: getRecordSetTags("", "team-a")})
+	iam := newFakeIam(t, dns)
+
+	solver := NewSolver().(*OtcDnsSolver)
+	solver.statusWait = testStatusWaitPolicy
+	err := solver.Present(&v1alpha1.ChallengeRequest{
+		ResourceNamespace: "team-b",
+		ResolvedZone:      "example.com.",
+		ResolvedFQDN:      "_acme-challenge.example.com.",
+		Key:               "key-b",
+		Config:            iam.solverConfig(t, nil),
+	})
+	assert.NoError(t, err)
+
+	recordSets := dns.getRecordSets()
+	if assert.Len(t, recordSets, 1) {
+		assert.Equal(t, []string{`"key-a"`, `"key-b"`}, recordSets[0].Records)
+		assert.Equal(t, TagValueSharedNamespace, recordSets[0].Tags[TagKeyNamespace])
+	}
+	assert.Len(t, dns.getRequests("POST /project-id/DNS-public_recordset/"+recordSet.ID+"/tags/action"), 1)
+}
+
+// Tests, that a failed tagging does not fail the challenge.
+func TestPresentIgnoresTaggingFailure(t *testing.T) {
+	dns := newFakeDns(t, fakeZone{ID: "zone", Name: "example.com.", ZoneType: ZoneTypePublic})
+	dns.addRecordSet(fakeRecordSet{ZoneID: "zone", Name: "_acme-challenge.example.com.", Records: []string{`"key-a"`}, Tags: getRecordSetTags("", "team-a")})
+	dns.failWith = func(w http.ResponseWriter, r *http.Request) int {
+		if strings.HasSuffix(r.URL.Path, "/tags") {
+			return http.StatusForbidden
+		}
+		return 0
+	}
+	iam := newFakeIam(t, dns)
+
+	solver := NewSolver().(*OtcDnsSolver)
+	solver.statusWait = testStatusWaitPolicy
+	err := solver.Present(&v1alpha1.ChallengeRequest{
+		ResourceNamespace: "team-b",
+		ResolvedZone:      "example.com.",
+		ResolvedFQDN:      "_acme-challenge.example.com.",
+		Key:               "key-b",
+		Config:            iam.solverConfig(t, nil),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{`"key-a"`, `"key-b"`}, dns.getRecordSets()[0].Records)
+}
@@ -0,0 +1,131 @@
+package otcdns
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	otc "github.com/opentelekomcloud/gophertelekomcloud"
+	"k8s.io/klog"
+)
+
+// ===========================================================================
+// Retries
+// ===========================================================================
+
+// The retry policy of the DNS operations.
+// A failed request is retried on rate limiting (429), server errors (5xx) and connection failures.
+// The backoff doubles with every retry and is jittered, so the retries of concurrent challenges spread out.
+// A Retry-After header of the OTC API takes precedence over the backoff.
+// The SDK does not retry on its own. See contextTransport.
+type RetryPolicy struct {
+	// How often a failed request is retried. 0 disables the retries.
+	MaxRetries int
+	// The backoff before the first retry.
+	InitialBackoff time.Duration
+	// The upper limit of the backoff and of a Retry-After.
+	MaxBackoff time.Duration
+	// The total time an operation may spend including its retries. 0 means no limit besides MaxRetries.
+	// A running attempt is cancelled, when the budget is exhausted.
+	Budget time.Duration
+}
+
+// Runs the given attempt of an operation and retries it on transient failures.
+// Each attempt gets its own service client, that is cancelled with the context, after the given timeout
+// or when the retry budget is exhausted.
+// retry is 0 for the first attempt. Attempts of operations, that are not idempotent, must check
+// whether a previous attempt already succeeded, when retry is greater than 0.
+// The attempt must return the unwrapped error of the SDK.
+func (dnsClient *OtcDnsClient) withRetries(ctx context.Context, operation string, timeout time.Duration, attempt func(sc *otc.ServiceClient, retry int) error) error {
+	policy := dnsClient.Retry
+	start := time.Now()
+	attemptCtx := ctx
+	if policy.Budget > 0 {
+		var cancelBudget context.CancelFunc
+		attemptCtx, cancelBudget = context.WithDeadline(ctx, start.Add(policy.Budget))
+		defer cancelBudget()
+	}
+	for retry := 0; ; retry++ {
+		sc, transport, cancel := dnsClient.serviceClientWithTimeout(attemptCtx, timeout)
+		err := attempt(sc, retry)
+		cancel()
+		if err == nil {
+			return nil
+		}
+		err = dnsClient.wrapTokenRejectedError(err)
+		if ctx.Err() != nil || retry >= policy.MaxRetries || !isTransientError(err, transport.statusCode) {
+			return err
+		}
+
+		backoff := policy.backoff(retry, transport.retryAfter)
+		if policy.Budget > 0 && time.Since(start)+backoff > policy.Budget {
+			klog.Warningf("%s failed. The retry budget of %s is exhausted", operation, policy.Budget)
+			return err
+		}
+		klog.V(2).Infof("%s failed with a transient error. Retry %d of %d in %s. %s", operation, retry+1, policy.MaxRetries, backoff, err)
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// Returns the time to wait before the given retry. A Retry-After of the API is honoured up to MaxBackoff.
+func (policy RetryPolicy) backoff(retry int, retryAfter time.Duration) time.Duration {
+	if retryAfter > 0 {
+		if policy.MaxBackoff > 0 && retryAfter > policy.MaxBackoff {
+			return policy.MaxBackoff
+		}
+		return retryAfter
+	}
+
+	backoff := policy.InitialBackoff
+	for i := 0; i < retry && (policy.MaxBackoff <= 0 || backoff < policy.MaxBackoff); i++ {
+		backoff *= 2
+	}
+	if policy.MaxBackoff > 0 && backoff > policy.MaxBackoff {
+		backoff = policy.MaxBackoff
+	}
+	if backoff <= 0 {
+		return 0
+	}
+	// Equal jitter: Wait at least half of the backoff.
+	return backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+}
+
+// Tests, if the failed request may succeed, when it is sent again.
+// statusCode is the status of the last response. It is 0, when no response was received.
+func isTransientError(err error, statusCode int) bool {
+	switch statusCode {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	case 0:
+		// The connection failed, was reset or the attempt timed out.
+		var urlErr *url.Error
+		return errors.As(err, &urlErr)
+	default:
+		return false
+	}
+}
+
+// Parses a Retry-After header. It holds either seconds or an HTTP date.
+func parseRetryAfter(header string) time.Duration {
+	if header == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(header); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(header); err == nil {
+		return time.Until(date)
+	}
+	return 0
+}
@@ -0,0 +1,140 @@
+// The tests in this file test the retries of the DNS operations.
+package otcdns
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/opentelekomcloud/gophertelekomcloud/openstack/dns/v2/zones"
+	"github.com/stretchr/testify/assert"
+)
+
+// A retry policy with short backoffs for the tests.
+var testRetryPolicy = RetryPolicy{
+	MaxRetries:     3,
+	InitialBackoff: 10 * time.Millisecond,
+	MaxBackoff:     100 * time.Millisecond,
+	Budget:         10 * time.Second,
+}
+
+// Tests, if a rate limited request is retried after the Retry-After of the response.
+func TestRetryHonoursRetryAfter(t *testing.T) {
+	dns := newFakeDns(t, fakeZone{ID: "zone", Name: "example.com."})
+	var requestTimes []time.Time
+	dns.failWith = func(w http.ResponseWriter, r *http.Request) int {
+		requestTimes = append(requestTimes, time.Now())
+		if len(requestTimes) == 1 {
+			w.Header().Set("Retry-After", "1")
+			return http.StatusTooManyRequests
+		}
+		return 0
+	}
+
+	otcDnsClient := dns.client()
+	otcDnsClient.Retry = testRetryPolicy
+	otcDnsClient.Retry.MaxBackoff = 5 * time.Second
+
+	zone, err := otcDnsClient.GetHostedZoneWithContext(context.Background(), "example.com.")
+	assert.NoError(t, err)
+	assert.Equal(t, "zone", zone.ID)
+	// The SDK fetches the first page twice, when the request succeeds.
+	assert.Len(t, requestTimes, 3)
+	assert.GreaterOrEqual(t, requestTimes[1].Sub(requestTimes[0]), time.Second)
+}
+
+// Tests, if a client error is not retried.
+func TestRetryNotOnClientError(t *testing.T) {
+	dns := newFakeDns(t)
+	dns.failWith = func(w http.ResponseWriter, r *http.Request) int {
+		return http.StatusBadRequest
+	}
+
+	otcDnsClient := dns.client()
+	otcDnsClient.Retry = testRetryPolicy
+
+	_, err := otcDnsClient.ListZonesWithContext(context.Background())
+	assert.Error(t, err)
+	assert.Len(t, dns.getRequests("GET /zones"), 1)
+}
+
+// Tests, if the retries stop after MaxRetries.
+func TestRetryStopsAfterMaxRetries(t *testing.T) {
+	dns := newFakeDns(t)
+	dns.failWith = func(w http.ResponseWriter, r *http.Request) int {
+		return http.StatusServiceUnavailable
+	}
+
+	otcDnsClient := dns.client()
+	otcDnsClient.Retry = testRetryPolicy
+
+	_, err := otcDnsClient.ListZonesWithContext(context.Background())
+	assert.Error(t, err)
+	assert.Len(t, dns.getRequests("GET /zones"), 1+testRetryPolicy.MaxRetries)
+}
+
+// Tests, if a create, whose response was lost, is not executed twice.
+func TestRetryDoesNotCreateTwice(t *testing.T) {
+	dns := newFakeDns(t)
+	// The recordset is created, but the gateway fails afterwards.
+	dns.failWith = func(w http.ResponseWriter, r *http.Request) int {
+		if r.Method == http.MethodPost {
+			return http.StatusInternalServerError
+		}
+		return 0
+	}
+
+	otcDnsClient := dns.client()
+	otcDnsClient.Retry = testRetryPolicy
+
+	recordset, err := otcDnsClient.NewTxtRecordSetWithContext(context.Background(), &zones.Zone{ID: "zone", Name: "example.com."}, `"value"`)
+	assert.NoError(t, err)
+	assert.Equal(t, "recordset-1", recordset.ID)
+	assert.Len(t, dns.getRequests("POST /zones/zone/recordsets"), 1)
+	assert.Len(t, dns.getRecordSets(), 1)
+}
+
+// Tests, if the backoff grows exponentially within its bounds.
+func TestRetryBackoff(t *testing.T) {
+	policy := RetryPolicy{InitialBackoff: time.Second, MaxBackoff: 10 * time.Second}
+
+	for retry, maxBackoff := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second} {
+		backoff := policy.backoff(retry, 0)
+		assert.GreaterOrEqual(t, backoff, maxBackoff/2)
+		assert.LessOrEqual(t, backoff, maxBackoff)
+	}
+
+	assert.Equal(t, 3*time.Second, policy.backoff(0, 3*time.Second))
+	assert.Equal(t, 10*time.Second, policy.backoff(0, time.Hour))
+}
+
+// Tests, if gateway errors are retried by the retry policy only. The SDK would send every request twice otherwise.
+func TestRetryGatewayErrorsOnlyByPolicy(t *testing.T) {
+	dns := newFakeDns(t)
+	dns.failWith = func(w http.ResponseWriter, r *http.Request) int {
+		return http.StatusBadGateway
+	}
+
+	otcDnsClient := dns.client()
+	otcDnsClient.Retry = testRetryPolicy
+
+	_, err := otcDnsClient.ListZonesWithContext(context.Background())
+	assert.ErrorContains(t, err, "502")
+	assert.Len(t, dns.getRequests("GET /zones"), 1+testRetryPolicy.MaxRetries)
+}
+
+// Tests, if a hanging attempt is cancelled, when the retry budget is exhausted.
+func TestRetryBudgetCancelsAttempt(t *testing.T) {
+	dns := newFakeDns(t)
+	dns.failWith = hangUntilCancelled
+
+	otcDnsClient := dns.client()
+	otcDnsClient.Retry = testRetryPolicy
+	otcDnsClient.Retry.Budget = 200 * time.Millisecond
+
+	start := time.Now()
+	_, err := otcDnsClient.ListZonesWithContext(context.Background())
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), 2*time.Second, "The attempt must end with the budget.")
+}
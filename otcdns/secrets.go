@@ -0,0 +1,237 @@
+package otcdns
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	coreinformers "k8s.io/client-go/informers/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog"
+)
+
+// ===========================================================================
+// Secret cache
+// ===========================================================================
+
+const (
+	// How long we wait for the informer of a secret to fill its cache, before we fall back to a direct read.
+	secretSyncTimeout time.Duration = 10 * time.Second
+	// How long a secret the webhook may not watch is read directly, before a new informer is tried.
+	secretForbiddenTTL time.Duration = 5 * time.Minute
+	// The maximum number of secrets watched at the same time. Further secrets are read directly.
+	defaultMaxSecretInformers int = 100
+)
+
+// Caches the secrets referenced in the solver configurations.
+// An informer is started for every referenced secret on its first use. It watches this single secret only.
+// Listeners are notified, when the data of a watched secret changes or the secret is deleted.
+// Secrets the webhook may get but not list or watch, e.g. with a RBAC role limited to resourceNames, are read directly.
+type secretCache struct {
+	client       kubernetes.Interface
+	stopCh       <-chan struct{}
+	maxInformers int
+
+	mutex     sync.Mutex
+	informers map[string]*secretInformer
+	// The secrets that are read directly, because watching them is forbidden, and until when.
+	forbidden map[string]time.Time
+	listeners []func(namespace string, name string)
+}
+
+// The informer of a single secret.
+type secretInformer struct {
+	informer cache.SharedIndexInformer
+	// Closed, when the informer has synced or failed to sync.
+	synced     chan struct{}
+	syncedOnce sync.Once
+	syncErr    error
+	// Set, when the API server refused to list or watch the secret.
+	syncForbidden bool
+
+	stopOnce sync.Once
+	stopCh   chan struct{}
+}
+
+func newSecretCache(client kubernetes.Interface, stopCh <-chan struct{}) *secretCache {
+	return &secretCache{
+		client:       client,
+		stopCh:       stopCh,
+		maxInformers: defaultMaxSecretInformers,
+		informers:    map[string]*secretInformer{},
+		forbidden:    map[string]time.Time{},
+	}
+}
+
+// Registers a listener, that is called when a watched secret changes or is deleted.
+func (c *secretCache) OnChange(listener func(namespace string, name string)) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.listeners = append(c.listeners, listener)
+}
+
+// Returns the secret with the given name from the cache.
+// The secret is read directly from the API server, if its informer cannot be started, e.g. because of missing permissions.
+// A secret the webhook may not watch is read directly for secretForbiddenTTL, without trying a new informer.
+func (c *secretCache) Get(namespace string, name string) (*corev1.Secret, error) {
+	key := namespace + "/" + name
+
+	c.mutex.Lock()
+	if until, ok := c.forbidden[key]; ok {
+		if time.Now().Before(until) {
+			c.mutex.Unlock()
+			return c.getDirect(namespace, name)
+		}
+		delete(c.forbidden, key)
+	}
+	si, ok := c.informers[key]
+	if !ok {
+		if len(c.informers) >= c.maxInformers {
+			c.mutex.Unlock()
+			klog.V(4).Infof("secret %s is not cached. %d secrets are watched already", key, c.maxInformers)
+			return c.getDirect(namespace, name)
+		}
+		si = c.startInformer(namespace, name)
+		c.informers[key] = si
+	}
+	c.mutex.Unlock()
+
+	<-si.synced
+	if si.syncErr != nil {
+		c.mutex.Lock()
+		if c.informers[key] == si {
+			// Retry with a new informer on the next access, or after the TTL, when watching is forbidden.
+			delete(c.informers, key)
+			if si.syncForbidden {
+				c.forbidden[key] = time.Now().Add(secretForbiddenTTL)
+			}
+		}
+		c.mutex.Unlock()
+		if si.syncForbidden {
+			klog.Warningf("secret %s is not cached. It is read directly for %s. %s", key, secretForbiddenTTL, si.syncErr)
+		} else {
+			klog.Warningf("secret %s is not cached. %s", key, si.syncErr)
+		}
+		return c.getDirect(namespace, name)
+	}
+
+	obj, exists, err := si.informer.GetStore().GetByKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, apierrors.NewNotFound(corev1.Resource("secrets"), name)
+	}
+	return obj.(*corev1.Secret), nil
+}
+
+// Reads the secret directly from the API server.
+func (c *secretCache) getDirect(namespace string, name string) (*corev1.Secret, error) {
+	return c.client.CoreV1().Secrets(namespace).Get(context.Background(), name, metav1.GetOptions{})
+}
+
+// Starts an informer that watches the secret with the given name only.
+// Must be called with the mutex held.
+func (c *secretCache) startInformer(namespace string, name string) *secretInformer {
+	si := &secretInformer{
+		synced: make(chan struct{}),
+		stopCh: make(chan struct{}),
+	}
+	si.informer = coreinformers.NewFilteredSecretInformer(c.client, namespace, 0, cache.Indexers{}, func(options *metav1.ListOptions) {
+		options.FieldSelector = fields.OneTermEqualSelector("metadata.name", name).String()
+	})
+	_, err := si.informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldSecret, oldOk := oldObj.(*corev1.Secret)
+			newSecret, newOk := newObj.(*corev1.Secret)
+			if oldOk && newOk && reflect.DeepEqual(oldSecret.Data, newSecret.Data) {
+				// Resync or metadata change only.
+				return
+			}
+			c.notify(namespace, name)
+		},
+		DeleteFunc: func(obj interface{}) {
+			c.notify(namespace, name)
+		},
+	})
+	if err != nil {
+		si.finishSync(fmt.Errorf("cannot watch secret. %s", err), false)
+		return si
+	}
+	err = si.informer.SetWatchErrorHandler(func(r *cache.Reflector, err error) {
+		if apierrors.IsForbidden(err) {
+			// Retrying does not help. Do not wait for the sync timeout.
+			si.finishSync(fmt.Errorf("cannot watch secret. %s", err), true)
+			si.stop()
+			return
+		}
+		cache.DefaultWatchErrorHandler(r, err)
+	})
+	if err != nil {
+		si.finishSync(fmt.Errorf("cannot watch secret. %s", err), false)
+		return si
+	}
+
+	go si.informer.Run(si.stopCh)
+	go func() {
+		// The informer ends with the webhook.
+		select {
+		case <-c.stopCh:
+			si.stop()
+		case <-si.stopCh:
+		}
+	}()
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), secretSyncTimeout)
+		defer cancel()
+		go func() {
+			select {
+			case <-si.stopCh:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+		if !cache.WaitForCacheSync(ctx.Done(), si.informer.HasSynced) {
+			si.finishSync(fmt.Errorf("informer did not sync within %s", secretSyncTimeout), false)
+			si.stop()
+			return
+		}
+		si.finishSync(nil, false)
+	}()
+
+	return si
+}
+
+// Calls the listeners for the given secret.
+func (c *secretCache) notify(namespace string, name string) {
+	c.mutex.Lock()
+	listeners := make([]func(string, string), len(c.listeners))
+	copy(listeners, c.listeners)
+	c.mutex.Unlock()
+
+	for _, listener := range listeners {
+		listener(namespace, name)
+	}
+}
+
+// Records the result of the sync and releases the waiting readers. Only the first result counts.
+func (si *secretInformer) finishSync(err error, forbidden bool) {
+	si.syncedOnce.Do(func() {
+		si.syncErr = err
+		si.syncForbidden = forbidden
+		close(si.synced)
+	})
+}
+
+func (si *secretInformer) stop() {
+	si.stopOnce.Do(func() {
+		close(si.stopCh)
+	})
+}
@@ -0,0 +1,189 @@
+// The tests in this file test the secret cache against a fake Kubernetes API.
+package otcdns
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmfake "github.com/cert-manager/cert-manager/pkg/client/clientset/versioned/fake"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	extapi "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// Tests, if a rotated secret is detected and served from the cache.
+func TestSecretCacheRotation(t *testing.T) {
+	client := fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "cert-manager", Name: "otcdns-credentials"},
+		Data:       map[string][]byte{"accessKey": []byte("old")},
+	})
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+
+	secrets := newSecretCache(client, stopCh)
+	changed := make(chan string, 1)
+	secrets.OnChange(func(namespace string, name string) {
+		changed <- namespace + "/" + name
+	})
+
+	secret, err := secrets.Get("cert-manager", "otcdns-credentials")
+	if err != nil {
+		t.Fatalf("Unable to get secret: %v", err)
+	}
+	assert.Equal(t, "old", string(secret.Data["accessKey"]))
+
+	_, err = client.CoreV1().Secrets("cert-manager").Update(context.Background(), &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "cert-manager", Name: "otcdns-credentials"},
+		Data:       map[string][]byte{"accessKey": []byte("new")},
+	}, metav1.UpdateOptions{})
+	if err != nil {
+		t.Fatalf("Unable to update secret: %v", err)
+	}
+
+	select {
+	case key := <-changed:
+		assert.Equal(t, "cert-manager/otcdns-credentials", key)
+	case <-time.After(5 * time.Second):
+		t.Fatalf("The rotation of the secret was not detected.")
+	}
+
+	secret, err = secrets.Get("cert-manager", "otcdns-credentials")
+	if err != nil {
+		t.Fatalf("Unable to get secret: %v", err)
+	}
+	assert.Equal(t, "new", string(secret.Data["accessKey"]), "The cache must serve the rotated secret.")
+}
+
+// Tests, that a missing secret is reported as not found.
+func TestSecretCacheNotFound(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+
+	secrets := newSecretCache(client, stopCh)
+	_, err := secrets.Get("cert-manager", "missing")
+	assert.True(t, apierrors.IsNotFound(err), "A missing secret must be reported as not found.")
+}
+
+// Tests, that a secret the webhook may get but not watch is read directly without waiting for the sync timeout,
+// and that no new informer is started for it on the next access.
+func TestSecretCacheForbiddenWatch(t *testing.T) {
+	client := fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "otcdns-credentials"},
+		Data:       map[string][]byte{"accessKey": []byte("team-a")},
+	})
+	lists := 0
+	client.PrependReactor("list", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		lists++
+		return true, nil, apierrors.NewForbidden(corev1.Resource("secrets"), "", nil)
+	})
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+
+	secrets := newSecretCache(client, stopCh)
+	start := time.Now()
+	secret, err := secrets.Get("team-a", "otcdns-credentials")
+	if err != nil {
+		t.Fatalf("Unable to get secret: %v", err)
+	}
+	assert.Equal(t, "team-a", string(secret.Data["accessKey"]))
+	assert.Less(t, time.Since(start), secretSyncTimeout/2, "A forbidden watch must not wait for the sync timeout.")
+
+	listsBefore := lists
+	_, err = secrets.Get("team-a", "otcdns-credentials")
+	assert.NoError(t, err)
+	assert.Equal(t, listsBefore, lists, "No new informer must be started for a secret the webhook may not watch.")
+	assert.Empty(t, secrets.informers)
+}
+
+// Tests, that the secrets beyond the maximum number of informers are read directly.
+func TestSecretCacheMaxInformers(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "otcdns-credentials"}},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "team-b", Name: "otcdns-credentials"}},
+	)
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+
+	secrets := newSecretCache(client, stopCh)
+	secrets.maxInformers = 1
+	_, err := secrets.Get("team-a", "otcdns-credentials")
+	assert.NoError(t, err)
+	_, err = secrets.Get("team-b", "otcdns-credentials")
+	assert.NoError(t, err, "A secret beyond the maximum must be read directly.")
+	assert.Len(t, secrets.informers, 1)
+}
+
+// Tests, that only ClusterIssuers may reference secrets in the allowed namespaces, but the Issuers of other namespaces may not.
+func TestGetReferencedSecretInOtherNamespace(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "otc-credentials", Name: "otcdns-credentials"},
+			Data:       map[string][]byte{"accessKey": []byte("platform-ak")},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "other", Name: "otcdns-credentials"},
+			Data:       map[string][]byte{"accessKey": []byte("other-ak")},
+		},
+	)
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+
+	solver := &OtcDnsSolver{
+		secrets:                  newSecretCache(client, stopCh),
+		allowedSecretNamespaces:  []string{"otc-credentials"},
+		clusterResourceNamespace: "cert-manager",
+	}
+	keyRef := newSecretKeySelector("otcdns-credentials", "accessKey")
+	keyRef.Namespace = "otc-credentials"
+
+	accessKey, err := solver.getReferencedSecret("cert-manager", keyRef)
+	assert.NoError(t, err, "A ClusterIssuer may reference a secret in an allowed namespace.")
+	assert.Equal(t, "platform-ak", accessKey)
+
+	_, err = solver.getReferencedSecret("team-a", keyRef)
+	assert.ErrorContains(t, err, "Only ClusterIssuers", "An Issuer must not reference a secret in another namespace.")
+
+	keyRef.Namespace = "other"
+	_, err = solver.getReferencedSecret("cert-manager", keyRef)
+	assert.ErrorContains(t, err, envSecretNamespaces, "A ClusterIssuer must not reference a secret in a namespace, that is not allowed.")
+}
+
+// Tests, that an Issuer in the cluster resource namespace is not treated as a ClusterIssuer.
+// Only the configuration of a ClusterIssuer may reference secrets in other namespaces.
+func TestIssuerInClusterResourceNamespace(t *testing.T) {
+	clusterIssuerConfig := `{"accessKeySecretRef": {"name": "otcdns-credentials", "key": "accessKey", "namespace": "otc-credentials"}, "projectID": "platform"}`
+	issuerConfig := `{"accessKeySecretRef": {"name": "otcdns-credentials", "key": "accessKey", "namespace": "otc-credentials"}, "projectID": "team-a"}`
+	solver := &OtcDnsSolver{
+		allowedSecretNamespaces:  []string{"otc-credentials"},
+		clusterResourceNamespace: "cert-manager",
+		cmClient: cmfake.NewSimpleClientset(
+			&cmapi.ClusterIssuer{ObjectMeta: metav1.ObjectMeta{Name: "platform"}, Spec: newWebhookIssuerSpec(getGroupName(), clusterIssuerConfig)},
+			&cmapi.Issuer{ObjectMeta: metav1.ObjectMeta{Namespace: "cert-manager", Name: "team-a"}, Spec: newWebhookIssuerSpec(getGroupName(), issuerConfig)},
+		),
+	}
+	getConfig := func(raw string) *OtcDnsConfig {
+		config, err := configJsonToOtcDnsConfig(&extapi.JSON{Raw: []byte(raw)})
+		if err != nil {
+			t.Fatalf("Unable to decode config: %v", err)
+		}
+		return &config
+	}
+
+	assert.NoError(t, solver.checkSecretNamespaces(getConfig(clusterIssuerConfig), "cert-manager"), "A ClusterIssuer may reference a secret in an allowed namespace.")
+
+	err := solver.checkSecretNamespaces(getConfig(issuerConfig), "cert-manager")
+	assert.ErrorContains(t, err, "Only ClusterIssuers", "An Issuer in the cluster resource namespace must not reference a secret in another namespace.")
+	_, err = solver.getOtcDnsClientFromConfig(getConfig(issuerConfig), "cert-manager", false)
+	assert.ErrorContains(t, err, "Only ClusterIssuers")
+
+	assert.NoError(t, solver.checkSecretNamespaces(getConfig(`{"accessKeySecretRef": {"name": "otcdns-credentials", "key": "accessKey"}}`), "cert-manager"),
+		"An Issuer in the cluster resource namespace may reference the secrets of its namespace.")
+}
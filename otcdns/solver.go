@@ -2,23 +2,73 @@ package otcdns
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"reflect"
 	"strings"
+	"time"
 
 	"github.com/cert-manager/cert-manager/pkg/acme/webhook"
 	"github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	cmclient "github.com/cert-manager/cert-manager/pkg/client/clientset/versioned"
 	otc "github.com/opentelekomcloud/gophertelekomcloud"
 
 	// apiv1 "k8s.io/api/core/v1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	// "k8s.io/apimachinery/pkg/watch"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/klog"
 )
 
 func NewSolver() webhook.Solver {
-	return &OtcDnsSolver{}
+	return NewSolverWithCredentialProviders()
+}
+
+// Creates the solver with additional credential providers, e.g. for a custom secret broker.
+// The solver configurations select a provider by its name with credentialProvider.
+// A provider replaces the built-in provider with the same name.
+func NewSolverWithCredentialProviders(providers ...CredentialProvider) webhook.Solver {
+	solver := &OtcDnsSolver{
+		allowedSecretNamespaces:  getAllowedSecretNamespaces(),
+		clusterResourceNamespace: getClusterResourceNamespace(),
+		podName:                  getPodName(),
+		idTokenFile:              getIdTokenFile(),
+		idTokenExchanger:         newIdTokenExchanger(),
+	}
+	// The configuration from the environment is checked by Initialize. A misconfigured webhook must not start with defaults.
+	var configErrs []error
+	csmsCacheTTL, err := getCsmsCacheTTL()
+	configErrs = append(configErrs, err)
+	clientRefreshAfter, err := getDnsClientRefreshAfter()
+	configErrs = append(configErrs, err)
+	clientIdleTimeout, err := getDnsClientIdleTimeout()
+	configErrs = append(configErrs, err)
+	solver.clients = newDnsClientCache(clientRefreshAfter, clientIdleTimeout)
+	solver.timeouts, err = getDnsOperationTimeouts()
+	configErrs = append(configErrs, err)
+	solver.retryPolicy, err = getDnsRetryPolicy()
+	configErrs = append(configErrs, err)
+	rateLimitQPS, rateLimitBurst, err := getDnsRateLimit()
+	configErrs = append(configErrs, err)
+	solver.rateLimiters = newAccountRateLimiters(rateLimitQPS, rateLimitBurst)
+	solver.statusWait, err = getDnsStatusWaitPolicy()
+	configErrs = append(configErrs, err)
+	solver.preflightInterval, err = getPreflightInterval()
+	configErrs = append(configErrs, err)
+	solver.configErr = errors.Join(configErrs...)
+	solver.clusterName = getClusterName()
+	solver.clusterID = getClusterID()
+	solver.registerCredentialProviders(
+		&kubernetesSecretCredentialProvider{solver: solver},
+		newFileCredentialProvider(getCredentialFileDirs()),
+		&envCredentialProvider{},
+		newExecCredentialProvider(getCredentialExecCommand()),
+		newCsmsCredentialProvider(getCsmsEndpoint(), csmsCacheTTL),
+		newMetadataCredentialProvider(getMetadataEndpoint()),
+	)
+	solver.registerCredentialProviders(providers...)
+	return solver
 }
 
 // Solver implements the provider-specific logic needed to
@@ -27,11 +77,46 @@ func NewSolver() webhook.Solver {
 // interface.
 type OtcDnsSolver struct {
 	client *kubernetes.Clientset
-}
 
-type otcdnsSecrets struct {
-	AccessKey string
-	SecretKey string
+	// The referenced secrets. Each secret is watched by an informer after its first use.
+	secrets *secretCache
+
+	// The namespaces the secret references of ClusterIssuers may point to, in addition to the resource namespace of the challenge.
+	allowedSecretNamespaces []string
+	// The resource namespace of the challenges of ClusterIssuers (--cluster-resource-namespace of cert-manager).
+	clusterResourceNamespace string
+	// Lists the ClusterIssuers. Only their solver configurations may reference secrets in other namespaces.
+	cmClient cmclient.Interface
+
+	// The projected service account token of the webhook and the client that exchanges it for IAM tokens.
+	idTokenFile      string
+	idTokenExchanger *idTokenExchanger
+
+	// The credential providers by their names.
+	credentialProviders map[string]CredentialProvider
+
+	// The authenticated DNS clients. They are reused across challenges.
+	clients *dnsClientCache
+
+	// The timeouts and the retries of the DNS operations.
+	timeouts    OperationTimeouts
+	retryPolicy RetryPolicy
+	// The rate limiters of the OTC accounts. They are shared by all clients of an account.
+	rateLimiters *accountRateLimiters
+	// How long the changes of recordsets are awaited to become ACTIVE or deleted.
+	statusWait StatusWaitPolicy
+	// The name of the cluster. The description templates of the challenge recordsets can use it.
+	clusterName string
+	// The ID of the cluster. The challenge recordsets are tagged with it.
+	clusterID string
+	// The name of the pod of the webhook. It is part of the name of the test recordsets of the preflight check.
+	podName string
+	// How often the solver configurations of the Issuers and ClusterIssuers are checked. 0 disables the check.
+	preflightInterval time.Duration
+	// The errors in the configuration of the webhook from the environment. Initialize fails with them.
+	configErr error
+	// Cancelled, when the webhook stops. The running DNS operations are aborted then.
+	ctx context.Context
 }
 
 // Name is used as the name for this DNS solver when referencing it on the ACME
@@ -54,6 +139,9 @@ func (s *OtcDnsSolver) Name() string {
 // The stopCh can be used to handle early termination of the webhook, in cases
 // where a SIGTERM or similar signal is sent to the webhook process.
 func (s *OtcDnsSolver) Initialize(kubeClientConfig *rest.Config, stopCh <-chan struct{}) error {
+	if s.configErr != nil {
+		return fmt.Errorf("invalid configuration of the webhook. %s", s.configErr)
+	}
 
 	clientSet, err := kubernetes.NewForConfig(kubeClientConfig)
 	if err != nil {
@@ -61,9 +149,42 @@ func (s *OtcDnsSolver) Initialize(kubeClientConfig *rest.Config, stopCh <-chan s
 	}
 
 	s.client = clientSet
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-stopCh
+		cancel()
+	}()
+	s.ctx = ctx
+
+	s.secrets = newSecretCache(clientSet, stopCh)
+	s.secrets.OnChange(s.onSecretChange)
+	if s.clients != nil {
+		go s.clients.Run(stopCh)
+	}
+
+	cmClientSet, err := cmclient.NewForConfig(kubeClientConfig)
+	if err != nil {
+		return err
+	}
+	s.cmClient = cmClientSet
+
+	// Check the solver configurations of the Issuers and ClusterIssuers periodically.
+	if s.preflightInterval > 0 {
+		healthChecker := newIssuerHealthChecker(cmClientSet, s, s.preflightInterval)
+		go healthChecker.Run(stopCh)
+	}
 	return nil
 }
 
+// Called when a referenced secret changes or is deleted, e.g. when credentials are rotated.
+// The clients are cached by a fingerprint of the credentials. The next challenge authenticates with the new credentials.
+// The client of the old credentials is evicted, when it is idle.
+func (s *OtcDnsSolver) onSecretChange(namespace string, name string) {
+	klog.Infof("secret %s/%s changed. The next challenge uses the new content", namespace, name)
+	s.clients.EvictSecret(namespace, name)
+}
+
 // Present is responsible for actually presenting the DNS record with the DNS provider.
 // This method should tolerate being called multiple times with the same value.
 // cert-manager itself will later perform a self check to ensure that the solver has correctly configured the DNS provider.
@@ -74,29 +195,35 @@ func (s *OtcDnsSolver) Initialize(kubeClientConfig *rest.Config, stopCh <-chan s
 func (s *OtcDnsSolver) Present(challengeRequest *v1alpha1.ChallengeRequest) error {
 	klog.Infof("call function Present: namespace=%s, zone=%s, fqdn=%s", challengeRequest.ResourceNamespace, challengeRequest.ResolvedZone, challengeRequest.ResolvedFQDN)
 
-	otcdnsClient, err := s.getOtcDnsClientFromChallengeRequest(challengeRequest)
+	otcdnsClient, config, err := s.getOtcDnsClientFromChallengeRequest(challengeRequest)
 	if err != nil {
 		return fmt.Errorf("cannot present. Failed to get dns client. %s", err)
 	}
 
+	ctx := s.context()
+
 	// Check, if the TXT record already exists.
-	zone, err := otcdnsClient.GetHostedZone(challengeRequest.ResolvedZone)
+	zone, err := s.getHostedZoneFromChallengeRequest(ctx, otcdnsClient, config, challengeRequest)
 	if err != nil {
 		return fmt.Errorf("cannot present. Failed to get hosted zone %s. %s", challengeRequest.ResolvedZone, err)
 	}
 
 	safeChallengeRequestKey := s.getSafeTxtValue(challengeRequest.Key)
-	challengeExists, existingRecordset, err := otcdnsClient.HasTxtRecordValue(zone, safeChallengeRequestKey)
+	challengeExists, existingRecordset, err := otcdnsClient.HasTxtRecordValueWithContext(ctx, zone, safeChallengeRequestKey)
 	if err != nil {
 		return fmt.Errorf("failed to check existence of DNS TXT entry. %s", err)
 	}
 
 	if challengeExists {
 		// The TXT challenge request entry is already present.
+		// A previous call may have returned before the change became ACTIVE, e.g. because it was cancelled.
 		klog.Infof("challenge request entry is already present. Skipping create.")
+		if _, err := otcdnsClient.waitForRecordSetActive(ctx, zone, existingRecordset); err != nil {
+			return fmt.Errorf("challenge request DNS TXT entry %s is present, but not active. %s", existingRecordset.Name, err)
+		}
 	} else if existingRecordset == nil {
 		// The whole recordset of the challenge request does not exist. Create it.
-		createdRecordset, err := otcdnsClient.NewTxtRecordSet(zone, safeChallengeRequestKey)
+		createdRecordset, err := otcdnsClient.NewTxtRecordSetWithContext(ctx, zone, safeChallengeRequestKey)
 		if err != nil {
 			return fmt.Errorf("failed to create new challenge request DNS TXT entry. %s", err)
 		}
@@ -105,11 +232,15 @@ func (s *OtcDnsSolver) Present(challengeRequest *v1alpha1.ChallengeRequest) erro
 		// The recordset exists, but the challenge request value is missing.
 		// Add record with challenge key.
 		changedRecords := append(existingRecordset.Records, safeChallengeRequestKey)
-		changedRecordset, err := otcdnsClient.UpdateTxtRecordValues(zone, existingRecordset, changedRecords)
+		changedRecordset, err := otcdnsClient.UpdateTxtRecordValuesWithContext(ctx, zone, existingRecordset, changedRecords)
 		if err != nil {
 			return fmt.Errorf("failed to update challenge DNS TXT entry. %s", err)
 		}
 		klog.Infof("changed challenge request DNS TXT entry %s with values %s", changedRecordset.Name, changedRecordset.Records)
+		// The recordset may have been created for a challenge of another namespace. The tags are for the audit only.
+		if err := otcdnsClient.TagSharedRecordSetWithContext(ctx, zone, changedRecordset); err != nil {
+			klog.Warningf("cannot mark challenge request DNS TXT entry %s as shared. %s", changedRecordset.Name, err)
+		}
 	}
 
 	klog.Infof("call function Present succeeded: namespace=%s, zone=%s, fqdn=%s", challengeRequest.ResourceNamespace, challengeRequest.ResolvedZone, challengeRequest.ResolvedFQDN)
@@ -123,26 +254,28 @@ func (s *OtcDnsSolver) Present(challengeRequest *v1alpha1.ChallengeRequest) erro
 func (s *OtcDnsSolver) CleanUp(challengeRequest *v1alpha1.ChallengeRequest) error {
 	klog.Infof("CleanUp: namespace=%s, zone=%s, fqdn=%s", challengeRequest.ResourceNamespace, challengeRequest.ResolvedZone, challengeRequest.ResolvedFQDN)
 
-	otcdnsClient, err := s.getOtcDnsClientFromChallengeRequest(challengeRequest)
+	otcdnsClient, config, err := s.getOtcDnsClientFromChallengeRequest(challengeRequest)
 	if err != nil {
 		return fmt.Errorf("cannot present. Failed to get dns client. %s", err)
 	}
 
+	ctx := s.context()
+
 	// Check, if the TXT record exists.
-	zone, err := otcdnsClient.GetHostedZone(challengeRequest.ResolvedZone)
+	zone, err := s.getHostedZoneFromChallengeRequest(ctx, otcdnsClient, config, challengeRequest)
 	if err != nil {
 		return fmt.Errorf("cannot CleanUp. Failed to get hosted zone. %s", err)
 	}
 
 	safeChallengeRequestKey := s.getSafeTxtValue(challengeRequest.Key)
-	challengeValueExists, existingRecordset, err := otcdnsClient.HasTxtRecordValue(zone, safeChallengeRequestKey)
+	challengeValueExists, existingRecordset, err := otcdnsClient.HasTxtRecordValueWithContext(ctx, zone, safeChallengeRequestKey)
 	if err != nil {
 		return fmt.Errorf("failed to check existence of DNS TXT entry. %s", err)
 	}
 
 	if challengeValueExists {
 		// The TXT challenge record exists. Delete the value or the whole recordset, if it is the last TXT value.
-		changedRecordSet, err := otcdnsClient.DeleteTxtRecordValue(zone, safeChallengeRequestKey, true)
+		changedRecordSet, err := otcdnsClient.DeleteTxtRecordValueWithContext(ctx, zone, safeChallengeRequestKey, true)
 		if err != nil {
 			return fmt.Errorf("failed to delete DNS TXT entry %s. %s", safeChallengeRequestKey, err)
 		}
@@ -163,51 +296,309 @@ func (s *OtcDnsSolver) CleanUp(challengeRequest *v1alpha1.ChallengeRequest) erro
 	return nil
 }
 
-// Create a otcDnsClient using the given information in the challenge.
-func (s *OtcDnsSolver) getOtcDnsClientFromChallengeRequest(challengeRequest *v1alpha1.ChallengeRequest) (*OtcDnsClient, error) {
+// Create a otcDnsClient using the given information in the challenge. Returns the decoded solver configuration, too.
+func (s *OtcDnsSolver) getOtcDnsClientFromChallengeRequest(challengeRequest *v1alpha1.ChallengeRequest) (*OtcDnsClient, *OtcDnsConfig, error) {
 	// Get the configuration from the challenge request.
 	// For the test this is injected via the config.json located in the ManifestPath (see SetManifestPath).
 	// For a real Kubernetes environment an example for the manifest yaml file can be found in _examples/secret_otcdns_credential.yaml
 	solverWebhookConfig, err := configJsonToOtcDnsConfig(challengeRequest.Config)
 	if err != nil {
-		return nil, fmt.Errorf("cannot create otcDnsClient. Json not converted. %s", err)
+		return nil, nil, fmt.Errorf("cannot create otcDnsClient. Json not converted. %s", err)
 	}
 	// fmt.Printf("Decoded configuration %v", solverWebhookConfig)
 	// klog.Infof("decoded configuration %v", solverWebhookConfig)
 
-	// Get the secrets from Kubernetes
-	secrets, err := s.getOtcDnsSecrets(&solverWebhookConfig, challengeRequest.ResourceNamespace)
+	otcDnsClient, err := s.getOtcDnsClientFromConfig(&solverWebhookConfig, challengeRequest.ResourceNamespace, challengeRequest.AllowAmbientCredentials)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := s.setChallengeRecordSetOptions(otcDnsClient, &solverWebhookConfig, challengeRequest); err != nil {
+		return nil, nil, fmt.Errorf("cannot create otcDnsClient. %s", err)
+	}
+
+	return otcDnsClient, &solverWebhookConfig, nil
+}
+
+// Sets the options of the recordsets, that the client creates for the given challenge:
+// the subdomain of the challenge, the description and the tags.
+func (s *OtcDnsSolver) setChallengeRecordSetOptions(otcDnsClient *OtcDnsClient, config *OtcDnsConfig, challengeRequest *v1alpha1.ChallengeRequest) error {
+	subdomain, _ := s.extractDomainAndSubdomainFromChallengeRequest(challengeRequest)
+	otcDnsClient.Subdomain = subdomain
+	description, err := s.getRecordSetDescription(config, challengeRequest)
+	if err != nil {
+		return err
+	}
+	otcDnsClient.Description = description
+	otcDnsClient.Tags = getRecordSetTags(s.clusterID, challengeRequest.ResourceNamespace)
+	return nil
+}
+
+// Create a otcDnsClient from the decoded solver configuration.
+// The secrets are loaded from the given resource namespace.
+func (s *OtcDnsSolver) getOtcDnsClientFromConfig(config *OtcDnsConfig, namespace string, allowAmbientCredentials bool) (*OtcDnsClient, error) {
+	ttl, err := config.getRecordSetTTL()
+	if err != nil {
+		return nil, fmt.Errorf("cannot create otcDnsClient. %s", err)
+	}
+	if err := s.checkSecretNamespaces(config, namespace); err != nil {
+		return nil, fmt.Errorf("cannot create otcDnsClient. %s", err)
+	}
+
+	var otcDnsClient *OtcDnsClient
+	if config.AuthType == AuthTypeOIDC {
+		// The service account token belongs to the webhook. It is an ambient credential like the OS_* variables.
+		if !allowAmbientCredentials {
+			return nil, fmt.Errorf("cannot create otcDnsClient. authType %q uses the service account of the webhook, but ambient credentials are not allowed for this issuer", AuthTypeOIDC)
+		}
+		otcDnsClient, err = s.getOtcDnsClientWithIdToken(config)
+	} else if config.hasCredentials() {
+		otcDnsClient, err = s.getOtcDnsClientWithSecrets(config, namespace, allowAmbientCredentials)
+	} else {
+		// No credentials configured. Fall back to the credentials of the webhook itself, if cert-manager allows it.
+		// cert-manager allows ambient credentials for ClusterIssuers by default and for Issuers only with --issuer-ambient-credentials.
+		if !allowAmbientCredentials {
+			return nil, fmt.Errorf("cannot create otcDnsClient. No credentials configured and ambient credentials are not allowed for this issuer")
+		}
+		klog.Infof("no credentials configured. Using the ambient credentials of the webhook")
+		otcDnsClient, err = s.getOtcDnsClientWithAmbientCredentials(config)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot create otcDnsClient. Failed to instantiate. %s", err)
+	}
+	otcDnsClient.TTL = ttl
+	otcDnsClient.Timeouts = s.timeouts
+	otcDnsClient.Retry = s.retryPolicy
+	otcDnsClient.RateLimiter = s.rateLimiters.Get(otcDnsClient.accountKey())
+	otcDnsClient.ZoneType = config.ZoneType
+	otcDnsClient.RouterID = config.RouterID
+	otcDnsClient.StatusWait = s.statusWait
+
+	return otcDnsClient, nil
+}
+
+// Returns the context of the DNS operations. It is cancelled, when the webhook stops.
+func (s *OtcDnsSolver) context() context.Context {
+	if s.ctx == nil {
+		return context.Background()
+	}
+	return s.ctx
+}
+
+// Create a otcDnsClient with the credentials referenced in the configuration.
+// The credentials are loaded by the credential provider selected in the configuration.
+func (s *OtcDnsSolver) getOtcDnsClientWithSecrets(config *OtcDnsConfig, namespace string, allowAmbientCredentials bool) (*OtcDnsClient, error) {
+	if config.CloudsYamlSecretRef.Name != "" {
+		return s.getOtcDnsClientWithCloudsYaml(config, namespace)
+	}
+
+	// Get the credentials from the provider. The Kubernetes secrets by default.
+	provider, err := s.getCredentialProvider(config)
 	if err != nil {
-		return nil, fmt.Errorf("cannot create otcDnsClient. Secrets not read. %s", err)
+		return nil, err
+	}
+	credentials, err := provider.GetCredentials(&CredentialRequest{
+		Config:                  config,
+		Namespace:               namespace,
+		AllowAmbientCredentials: allowAmbientCredentials,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("credentials not read from provider %q. %s", provider.Name(), err)
 	}
 
 	// Create the input parameters for the OtcDnsClient
-	// We use the accesskey/secretkey authentication here.
-	authOpts := otc.AKSKAuthOptions{
-		IdentityEndpoint: solverWebhookConfig.AuthURL,
-		AccessKey:        secrets.AccessKey,
-		SecretKey:        secrets.SecretKey,
+	authOpts, err := getAuthOptions(config, credentials)
+	if err != nil {
+		return nil, err
 	}
 
 	endpointOpts := otc.EndpointOpts{
-		Region: solverWebhookConfig.Region,
+		Region: config.Region,
 	}
 
 	klog.Infof("========================================================================================")
-	klog.Infof("authOpts.IdentityEndpoint=%s, authOpts.AccessKey=%s, endpointOpts.Region=%s, endpointOpts=%s", authOpts.IdentityEndpoint, authOpts.AccessKey, endpointOpts.Region, endpointOpts)
+	klog.Infof("credentialProvider=%s, authType=%s, authOpts.IdentityEndpoint=%s, endpointOpts.Region=%s, projectID=%s, projectName=%s, agencyName=%s, agencyDomainName=%s", provider.Name(), config.AuthType, authOpts.GetIdentityEndpoint(), endpointOpts.Region, config.ProjectID, config.ProjectName, config.AgencyName, config.AgencyDomainName)
 
 	// Create the client
-	otcDnsClient, err := NewDNSV2ClientWithAuth(authOpts, endpointOpts)
 	// This is an alternative way to create a client
 	// otcdnsClient, err := NewDNSV2Client()
+	var expiresAt time.Time
+	if credentials.ExpiresAt != nil {
+		expiresAt = *credentials.ExpiresAt
+	}
+	var secrets []string
+	if provider.Name() == CredentialProviderKubernetes {
+		secrets = s.getReferencedSecretKeys(config, namespace)
+	}
+	return s.getCachedOtcDnsClient(authOpts, endpointOpts, expiresAt, secrets)
+}
+
+// Create a otcDnsClient with the ambient credentials of the webhook.
+func (s *OtcDnsSolver) getOtcDnsClientWithAmbientCredentials(config *OtcDnsConfig) (*OtcDnsClient, error) {
+	cloud, err := getAmbientCloud()
 	if err != nil {
-		return nil, fmt.Errorf("cannot create otcDnsClient. Failed to instantiate. %s", err)
+		return nil, err
 	}
 
-	subdomain, _ := s.extractDomainAndSubdomainFromChallengeRequest(challengeRequest)
-	otcDnsClient.Subdomain = subdomain
+	authOpts, endpointOpts, err := getAuthOptionsFromCloud(cloud, config.Region)
+	if err != nil {
+		return nil, err
+	}
+	return s.getCachedOtcDnsClient(authOpts, endpointOpts, time.Time{}, nil)
+}
+
+// Returns the cached client for the given auth options. A new client is authenticated, when there is none or when it is due for a refresh.
+// expiresAt is the time the credentials expire. A zero time means unknown. The expiry of the token of the authentication
+// applies then, e.g. of a pre-issued token.
+// secrets are the Kubernetes secrets the credentials were loaded from. The client is evicted, when one of them changes.
+func (s *OtcDnsSolver) getCachedOtcDnsClient(authOpts otc.AuthOptionsProvider, endpointOpts otc.EndpointOpts, expiresAt time.Time, secrets []string) (*OtcDnsClient, error) {
+	return s.clients.GetForSecrets(dnsClientCacheKeyFromAuthOptions(authOpts, endpointOpts), secrets, func() (*OtcDnsClient, time.Time, error) {
+		otcDnsClient, err := NewDNSV2ClientWithAuth(authOpts, endpointOpts)
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+		if expiresAt.IsZero() {
+			return otcDnsClient, otcDnsClient.TokenExpiresAt, nil
+		}
+		return otcDnsClient, expiresAt, nil
+	})
+}
+
+// Create a otcDnsClient with an IAM token, that is issued for the service account token of the webhook.
+func (s *OtcDnsSolver) getOtcDnsClientWithIdToken(config *OtcDnsConfig) (*OtcDnsClient, error) {
+	if config.IdentityProviderID == "" {
+		return nil, fmt.Errorf("authType %q requires identityProviderID", AuthTypeOIDC)
+	}
+	if config.AgencyName != "" && config.AgencyDomainName == "" {
+		return nil, fmt.Errorf("agencyName %q is set, but agencyDomainName is missing", config.AgencyName)
+	}
+	if config.DomainName != "" {
+		// domainName is the domain of AK/SK credentials. It must not scope the exchanged token by accident.
+		return nil, fmt.Errorf("domainName is not used with authType %q. Set domainID to scope the token to a domain", AuthTypeOIDC)
+	}
+
+	idToken, err := readIdToken(s.idTokenFile)
+	if err != nil {
+		return nil, err
+	}
+
+	scope := idTokenScope{
+		ProjectID:   config.ProjectID,
+		ProjectName: config.ProjectName,
+		DomainID:    config.DomainID,
+	}
+	// The kubelet rotates the service account token. A rotated token is exchanged again.
+	key := dnsClientCacheKey(config.AuthURL, config.Region, config.ProjectID+"/"+config.ProjectName, idToken, config.IdentityProviderID, scope, config.AgencyName, config.AgencyDomainName, config.DelegatedProject)
+	return s.clients.Get(key, func() (*OtcDnsClient, time.Time, error) {
+		token, expiresAt, err := s.idTokenExchanger.Exchange(config.AuthURL, config.IdentityProviderID, idToken, scope)
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+
+		klog.Infof("========================================================================================")
+		klog.Infof("authType=%s, authURL=%s, identityProviderID=%s, region=%s, projectID=%s, projectName=%s, domainID=%s, tokenExpiresAt=%s", config.AuthType, config.AuthURL, config.IdentityProviderID, config.Region, config.ProjectID, config.ProjectName, config.DomainID, expiresAt)
+
+		authOpts := otc.AuthOptions{
+			IdentityEndpoint: config.AuthURL,
+			TokenID:          token,
+			AgencyName:       config.AgencyName,
+			AgencyDomainName: config.AgencyDomainName,
+			DelegatedProject: config.DelegatedProject,
+		}
+		endpointOpts := otc.EndpointOpts{
+			Region: config.Region,
+		}
+		otcDnsClient, err := NewDNSV2ClientWithAuth(authOpts, endpointOpts)
+		return otcDnsClient, expiresAt, err
+	})
+}
+
+// Create a otcDnsClient from a profile of the clouds.yaml referenced in the configuration.
+// The optional keys secure.yaml and clouds-public.yaml of the same secret are merged into the cloud.
+func (s *OtcDnsSolver) getOtcDnsClientWithCloudsYaml(config *OtcDnsConfig, namespace string) (*OtcDnsClient, error) {
+	data, err := s.getReferencedSecretData(namespace, config.CloudsYamlSecretRef)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get clouds.yaml: %s", err)
+	}
+	cloudsYaml, ok := data[config.CloudsYamlSecretRef.Key]
+	if !ok {
+		return nil, fmt.Errorf("cannot get clouds.yaml: key %q not found in secret %q", config.CloudsYamlSecretRef.Key, getSecretKey(namespace, config.CloudsYamlSecretRef))
+	}
+
+	cloud, err := getCloudFromCloudsYaml(cloudsYaml, data[cloudsSecureYamlKey], data[cloudsPublicYamlKey], config.CloudsProfile)
+	if err != nil {
+		return nil, err
+	}
+
+	klog.Infof("========================================================================================")
+	klog.Infof("cloudsProfile=%s, authURL=%s, region=%s", cloud.Cloud, cloud.AuthInfo.AuthURL, config.Region)
 
-	return otcDnsClient, err
+	authOpts, endpointOpts, err := getAuthOptionsFromCloud(cloud, config.Region)
+	if err != nil {
+		return nil, err
+	}
+	return s.getCachedOtcDnsClient(authOpts, endpointOpts, time.Time{}, []string{getSecretKey(namespace, config.CloudsYamlSecretRef)})
+}
+
+// Builds the auth options for the configured authentication method from the loaded secrets.
+func getAuthOptions(config *OtcDnsConfig, secrets *Credentials) (otc.AuthOptionsProvider, error) {
+	if config.AgencyName != "" && config.AgencyDomainName == "" {
+		return nil, fmt.Errorf("agencyName %q is set, but agencyDomainName is missing", config.AgencyName)
+	}
+
+	if secrets.Token != "" {
+		// A pre-issued token replaces the authentication. The scope of the token applies.
+		return otc.AuthOptions{
+			IdentityEndpoint: config.AuthURL,
+			TokenID:          secrets.Token,
+			AgencyName:       config.AgencyName,
+			AgencyDomainName: config.AgencyDomainName,
+			DelegatedProject: config.DelegatedProject,
+		}, nil
+	}
+
+	switch config.AuthType {
+	case "", AuthTypeAkSk:
+		if config.AgencyName != "" && config.DomainName == "" {
+			// The SDK needs the domain of the AK/SK credentials to assume the agency.
+			return nil, fmt.Errorf("agencyName %q is set, but domainName is missing. It is required to assume an agency with AK/SK credentials", config.AgencyName)
+		}
+		// We use the accesskey/secretkey authentication here.
+		return otc.AKSKAuthOptions{
+			IdentityEndpoint: config.AuthURL,
+			AccessKey:        secrets.AccessKey,
+			SecretKey:        secrets.SecretKey,
+			SecurityToken:    secrets.SecurityToken,
+			ProjectId:        config.ProjectID,
+			ProjectName:      config.ProjectName,
+			Domain:           config.DomainName,
+			AgencyName:       config.AgencyName,
+			AgencyDomainName: config.AgencyDomainName,
+			DelegatedProject: config.DelegatedProject,
+		}, nil
+	case AuthTypePassword:
+		// We use the IAM username/password authentication here.
+		// A project ID loaded from the secrets takes precedence over the configured project.
+		projectID := secrets.ProjectID
+		if projectID == "" {
+			projectID = config.ProjectID
+		}
+		return otc.AuthOptions{
+			IdentityEndpoint: config.AuthURL,
+			Username:         secrets.Username,
+			Password:         secrets.Password,
+			DomainName:       secrets.DomainName,
+			// The cached clients authenticate again, when their token expires.
+			AllowReauth:      true,
+			TenantID:         projectID,
+			TenantName:       config.ProjectName,
+			AgencyName:       config.AgencyName,
+			AgencyDomainName: config.AgencyDomainName,
+			DelegatedProject: config.DelegatedProject,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown authType %q", config.AuthType)
+	}
 }
 
 // Turns the given challenge key into a safe value we can store in DNS.
@@ -228,16 +619,33 @@ func (s *OtcDnsSolver) extractDomainAndSubdomainFromChallengeRequest(challengeRe
 }
 
 // The given webhook configuration contains the definitions of references to the secrets we want to load.
-func (s *OtcDnsSolver) getOtcDnsSecrets(config *OtcDnsConfig, namespace string) (*otcdnsSecrets, error) {
+// This is the "kubernetes" credential provider.
+func (s *OtcDnsSolver) getOtcDnsSecrets(config *OtcDnsConfig, namespace string) (*Credentials, error) {
+	if config.TokenSecretRef.Name != "" {
+		return s.getTokenSecret(config, namespace)
+	}
+
+	switch config.AuthType {
+	case "", AuthTypeAkSk:
+		return s.getAkSkSecrets(config, namespace)
+	case AuthTypePassword:
+		return s.getPasswordSecrets(config, namespace)
+	default:
+		return nil, fmt.Errorf("unknown authType %q", config.AuthType)
+	}
+}
+
+// Loads the access key and the secret key for the AK/SK authentication.
+func (s *OtcDnsSolver) getAkSkSecrets(config *OtcDnsConfig, namespace string) (*Credentials, error) {
 
-	secs := otcdnsSecrets{}
+	secs := Credentials{}
 
 	if config.AccessKey != "" {
 		// Secret configured directly in configuration. This shortcut must never be used in production.
 		secs.AccessKey = config.AccessKey
 	} else {
 		var err error
-		secs.AccessKey, err = s.getReferencedSecret(namespace, config.AccessKeySecretRef.Name, config.AccessKeySecretRef.Key)
+		secs.AccessKey, err = s.getReferencedSecret(namespace, config.AccessKeySecretRef)
 		if err != nil {
 			return nil, fmt.Errorf("cannot get access key: %s", err)
 		}
@@ -248,24 +656,180 @@ func (s *OtcDnsSolver) getOtcDnsSecrets(config *OtcDnsConfig, namespace string)
 		secs.SecretKey = config.SecretKey
 	} else {
 		var err error
-		secs.SecretKey, err = s.getReferencedSecret(namespace, config.SecretKeySecretRef.Name, config.SecretKeySecretRef.Key)
+		secs.SecretKey, err = s.getReferencedSecret(namespace, config.SecretKeySecretRef)
 		if err != nil {
 			return nil, fmt.Errorf("cannot get secret: %s", err)
 		}
 	}
 
+	if config.SecurityTokenSecretRef.Name != "" {
+		var err error
+		secs.SecurityToken, err = s.getReferencedSecret(namespace, config.SecurityTokenSecretRef)
+		if err != nil {
+			return nil, fmt.Errorf("cannot get security token: %s", err)
+		}
+	}
+
+	return &secs, nil
+}
+
+// Loads the username, password, domain name and the optional project ID for the IAM user authentication.
+func (s *OtcDnsSolver) getPasswordSecrets(config *OtcDnsConfig, namespace string) (*Credentials, error) {
+
+	secs := Credentials{}
+	var err error
+
+	secs.Username, err = s.getReferencedSecret(namespace, config.UsernameSecretRef)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get username: %s", err)
+	}
+
+	secs.Password, err = s.getReferencedSecret(namespace, config.PasswordSecretRef)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get password: %s", err)
+	}
+
+	secs.DomainName, err = s.getReferencedSecret(namespace, config.DomainNameSecretRef)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get domain name: %s", err)
+	}
+
+	if config.ProjectIDSecretRef.Name != "" {
+		secs.ProjectID, err = s.getReferencedSecret(namespace, config.ProjectIDSecretRef)
+		if err != nil {
+			return nil, fmt.Errorf("cannot get project ID: %s", err)
+		}
+	}
+
 	return &secs, nil
 }
 
+// Loads the pre-issued IAM token.
+func (s *OtcDnsSolver) getTokenSecret(config *OtcDnsConfig, namespace string) (*Credentials, error) {
+	token, err := s.getReferencedSecret(namespace, config.TokenSecretRef)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get token: %s", err)
+	}
+	return &Credentials{Token: strings.TrimSpace(token)}, nil
+}
+
+// Returns the "namespace/name" of the Kubernetes secrets referenced in the configuration.
+func (s *OtcDnsSolver) getReferencedSecretKeys(config *OtcDnsConfig, namespace string) []string {
+	var secrets []string
+	for _, keyRef := range []SecretKeySelector{
+		config.AccessKeySecretRef,
+		config.SecretKeySecretRef,
+		config.SecurityTokenSecretRef,
+		config.UsernameSecretRef,
+		config.PasswordSecretRef,
+		config.DomainNameSecretRef,
+		config.ProjectIDSecretRef,
+		config.TokenSecretRef,
+	} {
+		if keyRef.Name != "" {
+			secrets = append(secrets, getSecretKey(namespace, keyRef))
+		}
+	}
+	return secrets
+}
+
+// Checks, that the given configuration only references secrets in other namespaces, when it is the configuration of a ClusterIssuer.
+// The challenge request does not name the kind of its issuer. The resource namespace of a ClusterIssuer is the
+// cluster resource namespace, but an Issuer in this namespace has the same resource namespace.
+// The ClusterIssuers of this webhook are therefore searched for the configuration.
+func (s *OtcDnsSolver) checkSecretNamespaces(config *OtcDnsConfig, namespace string) error {
+	if namespace != s.clusterResourceNamespace {
+		// getReferencedSecret rejects the references to other namespaces.
+		return nil
+	}
+	otherNamespaces := false
+	for _, secret := range append(s.getReferencedSecretKeys(config, namespace), getSecretKey(namespace, config.CloudsYamlSecretRef)) {
+		if !strings.HasPrefix(secret, namespace+"/") {
+			otherNamespaces = true
+		}
+	}
+	if !otherNamespaces {
+		return nil
+	}
+
+	if s.cmClient == nil {
+		return fmt.Errorf("the secrets in other namespaces cannot be read. The ClusterIssuers cannot be listed before the webhook is initialized")
+	}
+	clusterIssuers, err := s.cmClient.CertmanagerV1().ClusterIssuers().List(s.context(), metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("the secrets in other namespaces cannot be read. Cannot list ClusterIssuers. %s", err)
+	}
+	groupName := getGroupName()
+	for _, clusterIssuer := range clusterIssuers.Items {
+		if clusterIssuer.Spec.ACME == nil {
+			continue
+		}
+		for _, solver := range clusterIssuer.Spec.ACME.Solvers {
+			if solver.DNS01 == nil || solver.DNS01.Webhook == nil {
+				continue
+			}
+			webhook := solver.DNS01.Webhook
+			if webhook.GroupName != groupName || webhook.SolverName != s.Name() {
+				continue
+			}
+			clusterIssuerConfig, err := configJsonToOtcDnsConfig(webhook.Config)
+			if err == nil && reflect.DeepEqual(clusterIssuerConfig, *config) {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("the configuration references secrets in other namespaces, but is not the configuration of a ClusterIssuer. Only ClusterIssuers may reference secrets in other namespaces. The secrets of an Issuer must be located in its namespace %q", namespace)
+}
+
+// Returns the "namespace/name" of the referenced secret. The secret is located in the given namespace, unless the reference names another one.
+func getSecretKey(namespace string, keyRef SecretKeySelector) string {
+	if keyRef.Namespace != "" {
+		namespace = keyRef.Namespace
+	}
+	return namespace + "/" + keyRef.Name
+}
+
 // Takes the given references and tries to load the secrets from the reference locations.
-func (s *OtcDnsSolver) getReferencedSecret(namespace string, keyRefName string, keyRefKey string) (string, error) {
-	secret, err := s.client.CoreV1().Secrets(namespace).Get(context.Background(), keyRefName, metav1.GetOptions{})
+// The secret is loaded from the given namespace, unless the reference names another allowed namespace.
+// Only ClusterIssuers may reference secrets in other namespaces. Their resource namespace is the cluster resource namespace.
+// The Issuers of a namespace must not read the secrets of other namespaces.
+func (s *OtcDnsSolver) getReferencedSecret(namespace string, keyRef SecretKeySelector) (string, error) {
+	data, err := s.getReferencedSecretData(namespace, keyRef)
 	if err != nil {
-		return "", fmt.Errorf("failed to load secret %q. %s", namespace+"/"+keyRefName, err)
+		return "", err
 	}
-	if accessKey, ok := secret.Data[keyRefKey]; ok {
-		return string(accessKey), nil
+	if value, ok := data[keyRef.Key]; ok {
+		return string(value), nil
 	} else {
-		return "", fmt.Errorf("key %q not found in secret %q", keyRefKey, namespace+"/"+keyRefName)
+		return "", fmt.Errorf("key %q not found in secret %q", keyRef.Key, getSecretKey(namespace, keyRef))
+	}
+}
+
+// Loads all keys of the referenced secret. The same namespace rules as for getReferencedSecret apply.
+func (s *OtcDnsSolver) getReferencedSecretData(namespace string, keyRef SecretKeySelector) (map[string][]byte, error) {
+	if keyRef.Namespace != "" && keyRef.Namespace != namespace {
+		if namespace != s.clusterResourceNamespace {
+			return nil, fmt.Errorf("secret %q is located in namespace %q. Only ClusterIssuers may reference secrets in other namespaces. The secrets of an Issuer must be located in its namespace %q", keyRef.Name, keyRef.Namespace, namespace)
+		}
+		if !s.isAllowedSecretNamespace(keyRef.Namespace) {
+			return nil, fmt.Errorf("secret %q is located in namespace %q, which is not allowed. Add the namespace to %s of the webhook", keyRef.Name, keyRef.Namespace, envSecretNamespaces)
+		}
+		namespace = keyRef.Namespace
+	}
+
+	secret, err := s.secrets.Get(namespace, keyRef.Name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load secret %q. %s", namespace+"/"+keyRef.Name, err)
+	}
+	return secret.Data, nil
+}
+
+// Tests, if secrets may be loaded from the given namespace.
+func (s *OtcDnsSolver) isAllowedSecretNamespace(namespace string) bool {
+	for _, allowedNamespace := range s.allowedSecretNamespaces {
+		if namespace == allowedNamespace {
+			return true
+		}
 	}
+	return false
 }
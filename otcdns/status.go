@@ -0,0 +1,147 @@
+package otcdns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	otc "github.com/opentelekomcloud/gophertelekomcloud"
+	"github.com/opentelekomcloud/gophertelekomcloud/openstack/dns/v2/recordsets"
+	"github.com/opentelekomcloud/gophertelekomcloud/openstack/dns/v2/zones"
+	"k8s.io/klog"
+)
+
+// ===========================================================================
+// Recordset status
+// ===========================================================================
+
+// The statuses of a recordset. The OTC DNS returns new, changed and deleted recordsets in a PENDING_ status.
+// The records are served by the name servers, when the recordset is ACTIVE.
+const (
+	recordSetStatusActive string = "ACTIVE"
+	recordSetStatusError  string = "ERROR"
+)
+
+// Returned when the OTC DNS could not apply a change of a recordset.
+var ErrRecordSetStatusError = errors.New("the recordset is in status ERROR")
+
+// How long the changes of recordsets are awaited. The OTC DNS applies the changes asynchronously.
+// A Timeout of 0 disables the waiting. The operations return as soon as the API accepted the change then.
+type StatusWaitPolicy struct {
+	// The time a change may take to become ACTIVE or to be deleted.
+	Timeout time.Duration
+	// The time between two polls of the status.
+	PollInterval time.Duration
+}
+
+// Waits until the given recordset is ACTIVE. Returns the ACTIVE recordset.
+// Fails, when the recordset is or reaches the status ERROR or is still pending after the timeout.
+func (dnsClient *OtcDnsClient) waitForRecordSetActive(ctx context.Context, zone *zones.Zone, recordset *recordsets.RecordSet) (*recordsets.RecordSet, error) {
+	if recordset.Status == recordSetStatusError {
+		return nil, fmt.Errorf("recordset %s (%s): %w", recordset.ID, recordset.Name, ErrRecordSetStatusError)
+	}
+	if dnsClient.StatusWait.Timeout <= 0 || recordset.Status == recordSetStatusActive {
+		return recordset, nil
+	}
+
+	status := recordset.Status
+	err := dnsClient.pollRecordSet(ctx, zone, recordset.ID, func(polled *recordsets.RecordSet) (bool, error) {
+		if polled == nil {
+			return false, fmt.Errorf("recordset %s was deleted while waiting for status %s", recordset.ID, recordSetStatusActive)
+		}
+		status = polled.Status
+		switch status {
+		case recordSetStatusActive:
+			recordset = polled
+			return true, nil
+		case recordSetStatusError:
+			return false, fmt.Errorf("recordset %s (%s): %w", recordset.ID, recordset.Name, ErrRecordSetStatusError)
+		default:
+			return false, nil
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("recordset %s did not become %s. Last status %s: %w", recordset.ID, recordSetStatusActive, status, err)
+	}
+	return recordset, nil
+}
+
+// Waits until the given recordset is deleted.
+// Fails, when the recordset reaches the status ERROR or still exists after the timeout.
+func (dnsClient *OtcDnsClient) waitForRecordSetDeleted(ctx context.Context, zone *zones.Zone, recordset *recordsets.RecordSet) error {
+	if dnsClient.StatusWait.Timeout <= 0 {
+		return nil
+	}
+
+	status := recordset.Status
+	err := dnsClient.pollRecordSet(ctx, zone, recordset.ID, func(polled *recordsets.RecordSet) (bool, error) {
+		if polled == nil {
+			return true, nil
+		}
+		status = polled.Status
+		if status == recordSetStatusError {
+			return false, fmt.Errorf("recordset %s (%s): %w", recordset.ID, recordset.Name, ErrRecordSetStatusError)
+		}
+		return false, nil
+	})
+	if err != nil {
+		return fmt.Errorf("recordset %s was not deleted. Last status %s: %w", recordset.ID, status, err)
+	}
+	return nil
+}
+
+// Reads the recordset every poll interval until done returns true or an error, or the wait timeout has passed.
+// done gets nil, when the recordset does not exist (any more).
+// Returns the error of the given context, when it is cancelled, e.g. because the webhook stops.
+func (dnsClient *OtcDnsClient) pollRecordSet(ctx context.Context, zone *zones.Zone, recordsetID string, done func(recordset *recordsets.RecordSet) (bool, error)) error {
+	parentCtx := ctx
+	ctx, cancel := context.WithTimeout(ctx, dnsClient.StatusWait.Timeout)
+	defer cancel()
+	stopped := func() error {
+		if parentCtx.Err() != nil {
+			return parentCtx.Err()
+		}
+		return fmt.Errorf("timed out after %s", dnsClient.StatusWait.Timeout)
+	}
+
+	pollInterval := dnsClient.StatusWait.PollInterval
+	if pollInterval <= 0 {
+		pollInterval = defaultDnsStatusPollInterval
+	}
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return stopped()
+		case <-ticker.C:
+		}
+
+		var polled *recordsets.RecordSet
+		err := dnsClient.withRetries(ctx, "get recordset "+recordsetID, dnsClient.Timeouts.Read, func(sc *otc.ServiceClient, retry int) error {
+			var err error
+			polled, err = recordsets.Get(sc, zone.ID, recordsetID).Extract()
+			var err404 otc.ErrDefault404
+			if errors.As(err, &err404) {
+				polled = nil
+				return nil
+			}
+			return err
+		})
+		if err != nil {
+			if ctx.Err() != nil {
+				return stopped()
+			}
+			return err
+		}
+
+		finished, err := done(polled)
+		if err != nil || finished {
+			return err
+		}
+		if polled != nil {
+			klog.V(4).Infof("recordset %s is in status %s", recordsetID, polled.Status)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+// The tests in this file test the waiting for the status of recordsets.
+package otcdns
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	"github.com/opentelekomcloud/gophertelekomcloud/openstack/dns/v2/recordsets"
+	"github.com/opentelekomcloud/gophertelekomcloud/openstack/dns/v2/zones"
+	"github.com/stretchr/testify/assert"
+)
+
+// A status wait policy with short polls for the tests.
+var testStatusWaitPolicy = StatusWaitPolicy{
+	Timeout:      time.Second,
+	PollInterval: 10 * time.Millisecond,
+}
+
+// Tests, if a new recordset is returned, when it is ACTIVE.
+func TestCreateWaitsForActive(t *testing.T) {
+	dns := newFakeDns(t)
+	dns.pollStatuses = []string{"PENDING_CREATE", "PENDING_CREATE", "ACTIVE"}
+
+	otcDnsClient := dns.client()
+	otcDnsClient.StatusWait = testStatusWaitPolicy
+
+	recordset, err := otcDnsClient.NewTxtRecordSetWithContext(context.Background(), &zones.Zone{ID: "zone", Name: "example.com."}, `"value"`)
+	assert.NoError(t, err)
+	assert.Equal(t, "ACTIVE", recordset.Status)
+	assert.Len(t, dns.getRequests("GET /zones/zone/recordsets/"+recordset.ID), 3)
+}
+
+// Tests, if an update fails, when the recordset reaches the status ERROR.
+func TestUpdateFailsOnError(t *testing.T) {
+	dns := newFakeDns(t)
+	dns.pollStatuses = []string{"PENDING_UPDATE", "ERROR"}
+	recordSet := dns.addRecordSet(fakeRecordSet{ZoneID: "zone", Name: "_acme-challenge.example.com."})
+
+	otcDnsClient := dns.client()
+	otcDnsClient.StatusWait = testStatusWaitPolicy
+
+	_, err := otcDnsClient.UpdateTxtRecordValuesWithContext(context.Background(), &zones.Zone{ID: "zone"}, &recordsets.RecordSet{ID: recordSet.ID}, []string{`"value"`})
+	assert.True(t, errors.Is(err, ErrRecordSetStatusError), "%v", err)
+}
+
+// Tests, if the waiting ends after the timeout, when the recordset stays pending.
+func TestCreateWaitTimesOut(t *testing.T) {
+	dns := newFakeDns(t)
+	dns.pollStatuses = []string{"PENDING_CREATE"}
+
+	otcDnsClient := dns.client()
+	otcDnsClient.StatusWait = StatusWaitPolicy{Timeout: 100 * time.Millisecond, PollInterval: 10 * time.Millisecond}
+
+	_, err := otcDnsClient.NewTxtRecordSetWithContext(context.Background(), &zones.Zone{ID: "zone", Name: "example.com."}, `"value"`)
+	assert.ErrorContains(t, err, "Last status PENDING_CREATE")
+	assert.ErrorContains(t, err, "timed out")
+}
+
+// Tests, if a delete waits until the recordset is gone.
+func TestDeleteWaitsForDeletion(t *testing.T) {
+	dns := newFakeDns(t)
+	dns.pollStatuses = []string{"PENDING_DELETE", ""}
+	recordSet := dns.addRecordSet(fakeRecordSet{ZoneID: "zone", Name: "_acme-challenge.example.com."})
+
+	otcDnsClient := dns.client()
+	otcDnsClient.StatusWait = testStatusWaitPolicy
+
+	err := otcDnsClient.DeleteRecordSetWithContext(context.Background(), &zones.Zone{ID: "zone"}, &recordsets.RecordSet{ID: recordSet.ID})
+	assert.NoError(t, err)
+	assert.Len(t, dns.getRequests("GET /zones/zone/recordsets/"+recordSet.ID), 2)
+}
+
+// Tests, if no status is polled, when the waiting is disabled.
+func TestNoWaitWithoutTimeout(t *testing.T) {
+	dns := newFakeDns(t)
+
+	recordset, err := dns.client().NewTxtRecordSetWithContext(context.Background(), &zones.Zone{ID: "zone", Name: "example.com."}, `"value"`)
+	assert.NoError(t, err)
+	assert.Equal(t, "PENDING_CREATE", recordset.Status)
+	assert.Empty(t, dns.getRequests("GET /zones/zone/recordsets/"+recordset.ID))
+}
+
+// Tests, if Present waits for a present challenge recordset, that is still pending, e.g. after a cancelled Present.
+func TestPresentWaitsForPendingRecordSet(t *testing.T) {
+	for _, test := range []struct {
+		name         string
+		pollStatuses []string
+		expectError  bool
+	}{
+		{name: "active", pollStatuses: []string{"PENDING_CREATE", "ACTIVE"}},
+		{name: "error", pollStatuses: []string{"PENDING_CREATE", "ERROR"}, expectError: true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			dns := newFakeDns(t, fakeZone{ID: "zone", Name: "example.com.", ZoneType: ZoneTypePublic})
+			recordSet := dns.addRecordSet(fakeRecordSet{ZoneID: "zone", Name: "_acme-challenge.example.com.", Records: []string{`"key"`}, Status: "PENDING_CREATE"})
+			dns.pollStatuses = test.pollStatuses
+			iam := newFakeIam(t, dns)
+
+			solver := NewSolver().(*OtcDnsSolver)
+			solver.statusWait = testStatusWaitPolicy
+			err := solver.Present(&v1alpha1.ChallengeRequest{
+				ResourceNamespace: "team-a",
+				ResolvedZone:      "example.com.",
+				ResolvedFQDN:      "_acme-challenge.example.com.",
+				Key:               "key",
+				Config:            iam.solverConfig(t, nil),
+			})
+			if test.expectError {
+				assert.ErrorContains(t, err, ErrRecordSetStatusError.Error())
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Len(t, dns.getRequests("GET /zones/zone/recordsets/"+recordSet.ID), 2)
+			assert.Empty(t, dns.getRequests("POST /zones/zone/recordsets"), "The present recordset must not be created again.")
+		})
+	}
+}
+
+// Tests, if the waiting returns the error of the context, when the webhook stops.
+func TestWaitReturnsContextError(t *testing.T) {
+	dns := newFakeDns(t)
+	dns.pollStatuses = []string{"PENDING_CREATE"}
+
+	otcDnsClient := dns.client()
+	otcDnsClient.StatusWait = testStatusWaitPolicy
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	_, err := otcDnsClient.NewTxtRecordSetWithContext(ctx, &zones.Zone{ID: "zone", Name: "example.com."}, `"value"`)
+	assert.True(t, errors.Is(err, context.Canceled), "%v", err)
+	assert.NotContains(t, err.Error(), "timed out")
+}
@@ -0,0 +1,186 @@
+package otcdns
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	otc "github.com/opentelekomcloud/gophertelekomcloud"
+)
+
+// ===========================================================================
+// HTTP transports for the provider client
+// ===========================================================================
+
+const (
+	securityTokenHeader string = "X-Security-Token"
+	// The longest part of the body of a gateway error, that is kept in the error.
+	maxGatewayErrorBodyLength int64 = 1024
+	// The longest part of the body of a failed authentication, that is kept for the classification of the error.
+	maxAuthenticationErrorBodyLength int64 = 4096
+)
+
+// Adds the security token of temporary AK/SK credentials to every request.
+// The gophertelekomcloud signer signs the request with the access key and the secret key only,
+// but the OTC API gateway rejects temporary credentials without the security token.
+type securityTokenTransport struct {
+	securityToken string
+	next          http.RoundTripper
+}
+
+func (t *securityTokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// A RoundTripper must not modify the given request.
+	clonedReq := req.Clone(req.Context())
+	clonedReq.Header.Set(securityTokenHeader, t.securityToken)
+	return t.nextTransport().RoundTrip(clonedReq)
+}
+
+func (t *securityTokenTransport) nextTransport() http.RoundTripper {
+	if t.next == nil {
+		return http.DefaultTransport
+	}
+	return t.next
+}
+
+// Records the last error response of the IAM during the authentication.
+// The SDK flattens the errors of the authentication to strings, so the status code and the error code
+// of a rejected token or of rejected credentials are lost otherwise.
+// The expiry of the token, that the IAM issued or validated last, is recorded, too. The SDK does not keep it.
+type authenticationResponseTransport struct {
+	next http.RoundTripper
+
+	// The last error response. The status code is 0, when the last request succeeded.
+	errorResponse otc.ErrUnexpectedResponseCode
+
+	// The time the last issued or validated token expires. Zero, when there was none.
+	tokenExpiresAt time.Time
+}
+
+func (t *authenticationResponseTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.nextTransport().RoundTrip(req)
+	if err != nil {
+		t.errorResponse = otc.ErrUnexpectedResponseCode{}
+		return nil, err
+	}
+	if resp.StatusCode < http.StatusBadRequest {
+		t.errorResponse = otc.ErrUnexpectedResponseCode{}
+		if strings.HasSuffix(req.URL.Path, "/auth/tokens") {
+			return t.recordTokenExpiry(resp)
+		}
+		return resp, nil
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxAuthenticationErrorBodyLength))
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	t.errorResponse = otc.ErrUnexpectedResponseCode{
+		URL:    req.URL.String(),
+		Method: req.Method,
+		Actual: resp.StatusCode,
+		Body:   body,
+	}
+	return resp, nil
+}
+
+// Records the expiry of the token in the body of the given response of the IAM. The body stays readable.
+func (t *authenticationResponseTransport) recordTokenExpiry(resp *http.Response) (*http.Response, error) {
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	var token struct {
+		Token struct {
+			ExpiresAt time.Time `json:"expires_at"`
+		} `json:"token"`
+	}
+	if err := json.Unmarshal(body, &token); err == nil {
+		t.tokenExpiresAt = token.Token.ExpiresAt
+	}
+	return resp, nil
+}
+
+func (t *authenticationResponseTransport) nextTransport() http.RoundTripper {
+	if t.next == nil {
+		return http.DefaultTransport
+	}
+	return t.next
+}
+
+// Returns the given authentication error together with the recorded error response, if there is one.
+func (t *authenticationResponseTransport) wrapError(err error) error {
+	if t.errorResponse.Actual == 0 {
+		return err
+	}
+	return &authenticationError{err: err, response: t.errorResponse}
+}
+
+// An error of the authentication, that keeps the error response of the IAM for errors.As.
+type authenticationError struct {
+	err      error
+	response otc.ErrUnexpectedResponseCode
+}
+
+func (e *authenticationError) Error() string {
+	return e.err.Error()
+}
+
+func (e *authenticationError) Unwrap() []error {
+	return []error{e.err, e.response}
+}
+
+// Binds every request to the given context. The SDK creates its requests without a context,
+// so a hanging OTC endpoint would block the caller until the HTTP client gives up.
+// The transport also records the last response, the retries are decided on.
+// Gateway errors (502, 504) are returned as errors. The SDK would send the request once more after 500ms otherwise,
+// which bypasses the retry policy and sends a create twice. The retries of withRetries take over.
+type contextTransport struct {
+	ctx  context.Context
+	next http.RoundTripper
+	// Optional rate limiter of the account. Every request waits for it.
+	limiter RateLimiter
+
+	// The status code and the Retry-After header of the last response. The status code is 0, when no response was received.
+	statusCode int
+	retryAfter time.Duration
+}
+
+func (t *contextTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.limiter != nil {
+		if err := t.limiter.Wait(t.ctx); err != nil {
+			t.statusCode = 0
+			t.retryAfter = 0
+			return nil, err
+		}
+	}
+	resp, err := t.nextTransport().RoundTrip(req.WithContext(t.ctx))
+	if err != nil {
+		t.statusCode = 0
+		t.retryAfter = 0
+		return nil, err
+	}
+	t.statusCode = resp.StatusCode
+	t.retryAfter = parseRetryAfter(resp.Header.Get("Retry-After"))
+	if resp.StatusCode == http.StatusBadGateway || resp.StatusCode == http.StatusGatewayTimeout {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxGatewayErrorBodyLength))
+		return nil, fmt.Errorf("gateway error %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return resp, nil
+}
+
+func (t *contextTransport) nextTransport() http.RoundTripper {
+	if t.next == nil {
+		return http.DefaultTransport
+	}
+	return t.next
+}
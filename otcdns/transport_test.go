@@ -0,0 +1,62 @@
+// The tests in this file test the HTTP transports of the provider client.
+package otcdns
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Tests, if the security token is sent with every request, while the request of the caller is not modified.
+func TestSecurityTokenTransport(t *testing.T) {
+	var receivedTokens []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		receivedTokens = append(receivedTokens, r.Header.Get(securityTokenHeader))
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: &securityTokenTransport{securityToken: "security-token"}}
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatalf("Unable to create request: %v", err)
+	}
+	req.Header.Set("X-Sdk-Date", "20240501T120000Z")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Unable to send request: %v", err)
+	}
+	resp.Body.Close()
+
+	assert.Equal(t, []string{"security-token"}, receivedTokens)
+	assert.Empty(t, req.Header.Get(securityTokenHeader), "The request of the caller must not be modified.")
+	assert.Equal(t, "20240501T120000Z", req.Header.Get("X-Sdk-Date"))
+}
+
+// Tests, if the error response of a failed authentication is kept for the classification of the error.
+func TestAuthenticationResponseTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte(`{"error_code": "APIGW.0307", "error_msg": "The token must be updated."}`))
+	}))
+	defer server.Close()
+
+	transport := &authenticationResponseTransport{}
+	client := &http.Client{Transport: transport}
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Unable to send request: %v", err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.NoError(t, err)
+	assert.Contains(t, string(body), "APIGW.0307", "The body must still be readable by the SDK.")
+
+	err = transport.wrapError(errors.New("error extracting service catalog info: 403"))
+	assert.Equal(t, "error extracting service catalog info: 403", err.Error())
+	assert.True(t, isAuthenticationError(err))
+}
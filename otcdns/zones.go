@@ -0,0 +1,134 @@
+package otcdns
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	"github.com/opentelekomcloud/gophertelekomcloud/openstack/dns/v2/zones"
+	"k8s.io/klog"
+)
+
+// ===========================================================================
+// Zone discovery
+// ===========================================================================
+
+// The zone discovery modes, that can be selected with OtcDnsConfig.ZoneDiscovery.
+const (
+	// The zone cert-manager resolved with its SOA lookup (ResolvedZone) must be hosted in the account.
+	ZoneDiscoveryResolvedZone string = "resolvedZone"
+	// The deepest zone hosted in the account, that contains the challenge FQDN, is used.
+	// This works with split-horizon DNS and with subdomains that are delegated to another DNS.
+	ZoneDiscoveryLongestSuffix string = "longestSuffix"
+)
+
+// Returns the hosted zone of the challenge and points the client to the challenge FQDN in this zone.
+// A zone pinned by its ID takes precedence over the zone discovery. It must be owned by the project of the client
+// and be associated with the router of the client, like the discovered zones.
+func (s *OtcDnsSolver) getHostedZoneFromChallengeRequest(ctx context.Context, otcDnsClient *OtcDnsClient, config *OtcDnsConfig, challengeRequest *v1alpha1.ChallengeRequest) (*zones.Zone, error) {
+	if config.ZoneID != "" {
+		zone, err := otcDnsClient.GetHostedZoneByIDWithContext(ctx, config.ZoneID)
+		if err != nil {
+			return nil, err
+		}
+		if len(otcDnsClient.filterZonesByProject([]zones.Zone{*zone})) == 0 {
+			return nil, fmt.Errorf("zone %s with ID %s is owned by project %s, not by the project %s of the client", zone.Name, zone.ID, zone.ProjectID, otcDnsClient.ProjectID)
+		}
+		if len(otcDnsClient.filterZonesByRouter([]zones.Zone{*zone})) == 0 {
+			return nil, fmt.Errorf("private zone %s with ID %s is not associated with the router %s", zone.Name, zone.ID, otcDnsClient.RouterID)
+		}
+		if !isDnsNameInZone(challengeRequest.ResolvedFQDN, zone.Name) {
+			return nil, fmt.Errorf("%s is not inside the zone %s with ID %s", challengeRequest.ResolvedFQDN, zone.Name, zone.ID)
+		}
+		otcDnsClient.Subdomain = getSubdomain(challengeRequest.ResolvedFQDN, zone.Name)
+		return zone, nil
+	}
+
+	switch config.ZoneDiscovery {
+	case "", ZoneDiscoveryResolvedZone:
+		return otcDnsClient.GetHostedZoneWithContext(ctx, challengeRequest.ResolvedZone)
+	case ZoneDiscoveryLongestSuffix:
+		zone, err := otcDnsClient.FindHostedZoneWithContext(ctx, challengeRequest.ResolvedFQDN)
+		if err != nil {
+			return nil, err
+		}
+		if !strings.EqualFold(zone.Name, challengeRequest.ResolvedZone) {
+			klog.Infof("using hosted zone %s for %s instead of the resolved zone %s", zone.Name, challengeRequest.ResolvedFQDN, challengeRequest.ResolvedZone)
+		}
+		otcDnsClient.Subdomain = getSubdomain(challengeRequest.ResolvedFQDN, zone.Name)
+		return zone, nil
+	default:
+		return nil, fmt.Errorf("unknown zoneDiscovery %q", config.ZoneDiscovery)
+	}
+}
+
+// Finds the deepest hosted zone, that contains the given FQDN (e.g. _acme-challenge.www.example.com.).
+func (dnsClient *OtcDnsClient) FindHostedZone(fqdn string) (*zones.Zone, error) {
+	return dnsClient.FindHostedZoneWithContext(context.Background(), fqdn)
+}
+
+// Finds the deepest hosted zone, that contains the given FQDN. The request is cancelled with the context or after the read timeout.
+// The labels of the FQDN are walked from the most to the least specific. The first name the account hosts a zone for wins.
+func (dnsClient *OtcDnsClient) FindHostedZoneWithContext(ctx context.Context, fqdn string) (*zones.Zone, error) {
+	allZones, err := dnsClient.ListZonesWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	zonesByName := map[string][]zones.Zone{}
+	for _, zone := range allZones {
+		name := normalizeDnsName(zone.Name)
+		zonesByName[name] = append(zonesByName[name], zone)
+	}
+
+	for name := normalizeDnsName(fqdn); name != "."; name = parentDnsName(name) {
+		candidates, ok := zonesByName[name]
+		if !ok {
+			continue
+		}
+		// We need exactly 1 zone to operate on
+		if len(candidates) != 1 {
+			return nil, fmt.Errorf("zone query with %s returned %d zones. Expected: 1", name, len(candidates))
+		}
+		return &candidates[0], nil
+	}
+
+	return nil, fmt.Errorf("no hosted zone found for %s", fqdn)
+}
+
+// Returns the part of the FQDN in front of the zone, e.g. "_acme-challenge.www" for "_acme-challenge.www.example.com." in "example.com.".
+// The apex of the zone is returned as "@".
+func getSubdomain(fqdn string, zoneName string) string {
+	name := normalizeDnsName(fqdn)
+	zoneName = normalizeDnsName(zoneName)
+	if name == zoneName {
+		return zoneApex
+	}
+	return strings.TrimSuffix(name, "."+zoneName)
+}
+
+// Tests, if the name is the zone name or a name below the zone, e.g. "_acme-challenge.example.com." in "example.com.".
+func isDnsNameInZone(name string, zoneName string) bool {
+	name = normalizeDnsName(name)
+	zoneName = normalizeDnsName(zoneName)
+	return name == zoneName || strings.HasSuffix(name, "."+zoneName)
+}
+
+// Lower cases the name and appends the trailing dot of a fully qualified name.
+func normalizeDnsName(name string) string {
+	name = strings.ToLower(name)
+	if !strings.HasSuffix(name, ".") {
+		name += "."
+	}
+	return name
+}
+
+// Removes the first label of the name, e.g. "www.example.com." becomes "example.com.". The root is ".".
+func parentDnsName(name string) string {
+	i := strings.Index(name, ".")
+	if i < 0 || i == len(name)-1 {
+		return "."
+	}
+	return name[i+1:]
+}
@@ -0,0 +1,244 @@
+// The tests in this file test the zone lookup and the zone discovery.
+package otcdns
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	"github.com/stretchr/testify/assert"
+)
+
+// Tests, if the deepest zone containing the FQDN is found.
+func TestFindHostedZone(t *testing.T) {
+	dns := newFakeDns(t,
+		fakeZone{ID: "example", Name: "example.com."},
+		fakeZone{ID: "sub", Name: "sub.example.com."},
+		fakeZone{ID: "other", Name: "other.org."},
+	)
+	otcDnsClient := dns.client()
+
+	for fqdn, zoneID := range map[string]string{
+		"_acme-challenge.www.sub.example.com.": "sub",
+		"_acme-challenge.sub.example.com.":     "sub",
+		"_acme-challenge.www.example.com.":     "example",
+		"_acme-challenge.Example.COM":          "example",
+		"sub.example.com.":                     "sub",
+	} {
+		zone, err := otcDnsClient.FindHostedZone(fqdn)
+		if assert.NoError(t, err, fqdn) {
+			assert.Equal(t, zoneID, zone.ID, fqdn)
+		}
+	}
+
+	_, err := otcDnsClient.FindHostedZone("_acme-challenge.example.net.")
+	assert.Error(t, err)
+}
+
+// Tests, if zones with the same name are rejected.
+func TestFindHostedZoneAmbiguous(t *testing.T) {
+	dns := newFakeDns(t,
+		fakeZone{ID: "public", Name: "example.com."},
+		fakeZone{ID: "private", Name: "example.com.", ZoneType: ZoneTypePrivate},
+	)
+	otcDnsClient := dns.client()
+	otcDnsClient.ZoneType = ZoneTypeBoth
+
+	_, err := otcDnsClient.FindHostedZone("_acme-challenge.example.com.")
+	assert.ErrorContains(t, err, "returned 2 zones")
+}
+
+// Tests, if the longest suffix discovery points the client to the FQDN in the discovered zone.
+func TestHostedZoneDiscoveryLongestSuffix(t *testing.T) {
+	dns := newFakeDns(t,
+		fakeZone{ID: "example", Name: "example.com."},
+		fakeZone{ID: "sub", Name: "sub.example.com."},
+	)
+	otcDnsClient := dns.client()
+
+	// cert-manager resolved the parent zone, e.g. because of split-horizon DNS.
+	challengeRequest := &v1alpha1.ChallengeRequest{
+		ResolvedFQDN: "_acme-challenge.www.sub.example.com.",
+		ResolvedZone: "example.com.",
+	}
+	solver := &OtcDnsSolver{}
+	zone, err := solver.getHostedZoneFromChallengeRequest(context.Background(), otcDnsClient, &OtcDnsConfig{ZoneDiscovery: ZoneDiscoveryLongestSuffix}, challengeRequest)
+	assert.NoError(t, err)
+	assert.Equal(t, "sub", zone.ID)
+	assert.Equal(t, "_acme-challenge.www", otcDnsClient.Subdomain)
+	assert.Equal(t, "_acme-challenge.www.sub.example.com.", otcDnsClient.getDnsName(zone.Name))
+
+	_, err = solver.getHostedZoneFromChallengeRequest(context.Background(), otcDnsClient, &OtcDnsConfig{ZoneDiscovery: "unknown"}, challengeRequest)
+	assert.Error(t, err)
+}
+
+// Tests, if the subdomain is the part of the FQDN in front of the zone.
+func TestGetSubdomain(t *testing.T) {
+	assert.Equal(t, "_acme-challenge.www", getSubdomain("_acme-challenge.www.example.com.", "example.com."))
+	assert.Equal(t, "_acme-challenge", getSubdomain("_acme-challenge.example.com", "example.com."))
+	assert.Equal(t, zoneApex, getSubdomain("_acme-challenge.example.com.", "_acme-challenge.example.com."))
+
+	otcDnsClient := &OtcDnsClient{Subdomain: zoneApex}
+	assert.Equal(t, "_acme-challenge.example.com.", otcDnsClient.getDnsName("_acme-challenge.example.com."))
+}
+
+// The zones of a fake DNS API, that hosts a public and two private zones with the same name.
+var fakeZonesOfAllTypes = []fakeZone{
+	{ID: "public", Name: "example.com.", ZoneType: ZoneTypePublic},
+	{ID: "private-a", Name: "example.com.", ZoneType: ZoneTypePrivate, Routers: []map[string]string{{"router_id": "vpc-a"}}},
+	{ID: "private-b", Name: "example.com.", ZoneType: ZoneTypePrivate, Routers: []map[string]string{{"router_id": "vpc-b"}}},
+}
+
+// Tests, if the zones are listed for the zone type and the private zones are filtered by the router.
+func TestGetHostedZoneByZoneType(t *testing.T) {
+	dns := newFakeDns(t, fakeZonesOfAllTypes...)
+	otcDnsClient := dns.client()
+	queriedTypes := func() []string {
+		var types []string
+		for _, request := range dns.getRequests("GET /zones") {
+			types = append(types, request.Query.Get("type"))
+		}
+		return types
+	}
+
+	zone, err := otcDnsClient.GetHostedZone("example.com.")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "public", zone.ID)
+	}
+	assert.Contains(t, queriedTypes(), "", "no type is queried by default")
+
+	otcDnsClient.ZoneType = ZoneTypePrivate
+	_, err = otcDnsClient.GetHostedZone("example.com.")
+	assert.ErrorContains(t, err, "returned 2 zones")
+
+	otcDnsClient.RouterID = "vpc-b"
+	zone, err = otcDnsClient.GetHostedZone("example.com.")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "private-b", zone.ID)
+	}
+
+	// The router does not filter the public zone.
+	otcDnsClient.ZoneType = ZoneTypeBoth
+	allZones, err := otcDnsClient.ListZones()
+	assert.NoError(t, err)
+	assert.Len(t, allZones, 2)
+	assert.Contains(t, queriedTypes(), ZoneTypePublic)
+
+	otcDnsClient.ZoneType = "unknown"
+	_, err = otcDnsClient.ListZones()
+	assert.ErrorContains(t, err, "unknown zoneType")
+}
+
+// Tests, if a pinned zone is fetched by its ID and the FQDN must be inside it.
+func TestHostedZonePinnedByID(t *testing.T) {
+	dns := newFakeDns(t, fakeZone{ID: "sub", Name: "sub.example.com.", ZoneType: ZoneTypePrivate})
+	otcDnsClient := dns.client()
+	solver := &OtcDnsSolver{}
+	config := &OtcDnsConfig{ZoneID: "sub", ZoneDiscovery: ZoneDiscoveryLongestSuffix}
+
+	zone, err := solver.getHostedZoneFromChallengeRequest(context.Background(), otcDnsClient, config, &v1alpha1.ChallengeRequest{
+		ResolvedFQDN: "_acme-challenge.www.sub.example.com.",
+		ResolvedZone: "example.com.",
+	})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "sub", zone.ID)
+		assert.Equal(t, "_acme-challenge.www.sub.example.com.", otcDnsClient.getDnsName(zone.Name))
+	}
+
+	_, err = solver.getHostedZoneFromChallengeRequest(context.Background(), otcDnsClient, config, &v1alpha1.ChallengeRequest{
+		ResolvedFQDN: "_acme-challenge.notsub.example.com.",
+		ResolvedZone: "example.com.",
+	})
+	assert.ErrorContains(t, err, "is not inside the zone")
+	assert.Empty(t, dns.getRequests("GET /zones"), "no zones are listed")
+}
+
+// Tests, that a pinned zone of another project or of another router is rejected.
+func TestHostedZonePinnedByIDOfOtherProjectOrRouter(t *testing.T) {
+	dns := newFakeDns(t,
+		fakeZone{ID: "other-project", Name: "example.com.", ZoneType: ZoneTypePublic, ProjectID: "project-b"},
+		fakeZone{ID: "other-router", Name: "example.com.", ZoneType: ZoneTypePrivate, ProjectID: "project-a", Routers: []map[string]string{{"router_id": "vpc-b"}}},
+		fakeZone{ID: "own-router", Name: "example.com.", ZoneType: ZoneTypePrivate, ProjectID: "project-a", Routers: []map[string]string{{"router_id": "vpc-a"}}},
+	)
+	otcDnsClient := dns.client()
+	otcDnsClient.ProjectID = "project-a"
+	otcDnsClient.RouterID = "vpc-a"
+	solver := &OtcDnsSolver{}
+	challengeRequest := &v1alpha1.ChallengeRequest{
+		ResolvedFQDN: "_acme-challenge.example.com.",
+		ResolvedZone: "example.com.",
+	}
+
+	_, err := solver.getHostedZoneFromChallengeRequest(context.Background(), otcDnsClient, &OtcDnsConfig{ZoneID: "other-project"}, challengeRequest)
+	assert.ErrorContains(t, err, "owned by project project-b")
+
+	_, err = solver.getHostedZoneFromChallengeRequest(context.Background(), otcDnsClient, &OtcDnsConfig{ZoneID: "other-router"}, challengeRequest)
+	assert.ErrorContains(t, err, "not associated with the router vpc-a")
+
+	zone, err := solver.getHostedZoneFromChallengeRequest(context.Background(), otcDnsClient, &OtcDnsConfig{ZoneID: "own-router"}, challengeRequest)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "own-router", zone.ID)
+	}
+}
+
+// Tests, if the zones of other projects are filtered, when the client is scoped to a project.
+func TestGetHostedZoneFiltersByProject(t *testing.T) {
+	dns := newFakeDns(t,
+		fakeZone{ID: "zone-a", Name: "example.com.", ProjectID: "project-a"},
+		fakeZone{ID: "zone-b", Name: "example.com.", ProjectID: "project-b"},
+		fakeZone{ID: "other-b", Name: "example.org.", ProjectID: "project-b"},
+	)
+	otcDnsClient := dns.client()
+
+	_, err := otcDnsClient.GetHostedZone("example.com.")
+	assert.ErrorContains(t, err, "returned 2 zones", "A client without a project sees the zones of all projects.")
+
+	otcDnsClient.ProjectID = "project-a"
+	zone, err := otcDnsClient.GetHostedZone("example.com.")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "zone-a", zone.ID)
+	}
+	_, err = otcDnsClient.GetHostedZone("example.org.")
+	assert.Error(t, err, "The zones of other projects must not be found.")
+
+	allZones, err := otcDnsClient.ListZones()
+	if assert.NoError(t, err) {
+		assert.Len(t, allZones, 1)
+	}
+
+	zone, err = otcDnsClient.FindHostedZone("_acme-challenge.www.example.com.")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "zone-a", zone.ID)
+	}
+}
+
+// Tests, if the AK/SK credentials are scoped to the configured project, and if the zones are looked up in this project.
+func TestSolverScopesAkSkToProject(t *testing.T) {
+	dns := newFakeDns(t,
+		fakeZone{ID: "zone-a", Name: "example.com.", ProjectID: "project-a"},
+		fakeZone{ID: "zone-b", Name: "example.com.", ProjectID: "project-b"},
+	)
+	iam := newFakeIam(t, dns)
+	solver := NewSolver().(*OtcDnsSolver)
+	config := &OtcDnsConfig{
+		AuthURL:   iam.authURL(),
+		Region:    "eu-de",
+		ProjectID: "project-a",
+		AccessKey: "ak",
+		SecretKey: "sk",
+	}
+
+	otcDnsClient, err := solver.getOtcDnsClientFromConfig(config, "team-a", false)
+	if err != nil {
+		t.Fatalf("Unable to create client: %v", err)
+	}
+	assert.Equal(t, "project-a", otcDnsClient.ProjectID)
+
+	zone, err := solver.getHostedZoneFromChallengeRequest(context.Background(), otcDnsClient, config, &v1alpha1.ChallengeRequest{
+		ResolvedFQDN: "_acme-challenge.example.com.",
+		ResolvedZone: "example.com.",
+	})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "zone-a", zone.ID)
+	}
+}